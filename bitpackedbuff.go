@@ -3,21 +3,102 @@
 
 package s2mdec
 
+import (
+	"bytes"
+	"io"
+)
+
 // Bit masks having as many ones at the lowest bits as the index.
 var bitMasks = [...]byte{0x00, 0x01, 0x03, 0x07, 0x0f, 0x1f, 0x3f, 0x7f, 0xff}
 
+// readerBufferSize is the size of the buffer used when bits are read from an io.Reader.
+const readerBufferSize = 4096
+
 // BitPackedBuff is the wrapper around a []byte providing access by arbitrary number of bits.
+// The bytes are either given at once, or pulled on demand from an io.Reader into a bounded buffer.
 type BitPackedBuff struct {
-	contents  []byte // Source of bits
-	bigEndian bool   // Tells if numbers constructed from read bits are coming in big endian byte order.
-	idx       int    // Index of the next byte from contents (this equals to bytes already read/processed)
-	cache     byte   // Cache of the byte whose bits are next
-	cacheBits byte   // Unused bits in cache
+	contents  []byte    // Source of bits
+	bigEndian bool      // Tells if numbers constructed from read bits are coming in big endian byte order.
+	idx       int       // Index of the next byte from contents (this equals to bytes already read/processed)
+	cache     byte      // Cache of the byte whose bits are next
+	cacheBits byte      // Unused bits in cache
+	src       io.Reader // Optional source contents is refilled from
+	srcErr    error     // Error returned by src, it is not read again afterwards
+	base      int64     // Bytes of src discarded from contents before contents[0]
+}
+
+// NewBitPackedBuffReader creates a new BitPackedBuff which pulls bytes on demand from r.
+// The buffer may read ahead of the bytes consumed, see BytesConsumed.
+func NewBitPackedBuffReader(r io.Reader, bigEndian bool) *BitPackedBuff {
+	return &BitPackedBuff{
+		contents:  make([]byte, 0, readerBufferSize),
+		bigEndian: bigEndian,
+		src:       r,
+	}
 }
 
 // EOF tells if end of buffer reached.
 func (b *BitPackedBuff) EOF() bool {
-	return b.cacheBits == 0 && b.idx >= len(b.contents)
+	return b.cacheBits == 0 && !b.available(1)
+}
+
+// BytesConsumed returns the number of bytes read from the beginning of the input,
+// including the partially read byte, if any.
+func (b *BitPackedBuff) BytesConsumed() int64 {
+	return b.base + int64(b.idx)
+}
+
+// available tells if at least n more bytes can be read from the buffer,
+// reading more from the source if needed and n fits into the buffer.
+func (b *BitPackedBuff) available(n int) bool {
+	if n <= len(b.contents)-b.idx {
+		return true
+	}
+	if b.src == nil || n > cap(b.contents) {
+		return false
+	}
+	b.fill(n)
+	return n <= len(b.contents)-b.idx
+}
+
+// fill discards the consumed bytes of the buffer,
+// and reads from the source until n bytes are available or the source is exhausted.
+func (b *BitPackedBuff) fill(n int) {
+	b.base += int64(b.idx)
+	b.contents = b.contents[:copy(b.contents[:cap(b.contents)], b.contents[b.idx:])]
+	b.idx = 0
+	for len(b.contents) < n && b.srcErr == nil {
+		m, err := b.src.Read(b.contents[len(b.contents):cap(b.contents)])
+		b.contents = b.contents[:len(b.contents)+m]
+		if err != nil {
+			b.srcErr = err
+		}
+	}
+}
+
+// errShort returns the error describing why bytes are not available:
+// the error of the source if it failed, io.ErrUnexpectedEOF otherwise.
+func (b *BitPackedBuff) errShort() error {
+	if b.srcErr != nil && b.srcErr != io.EOF {
+		return b.srcErr
+	}
+	return io.ErrUnexpectedEOF
+}
+
+// nextByte returns the next byte of the buffer.
+// It panics with the error of errShort if there are no more bytes.
+func (b *BitPackedBuff) nextByte() byte {
+	if !b.available(1) {
+		panic(b.errShort())
+	}
+	c := b.contents[b.idx]
+	b.idx++
+	return c
+}
+
+// bitOffset returns the number of bits already read from the buffer.
+func (b *BitPackedBuff) bitOffset() int64 {
+	return b.BytesConsumed()*8 - int64(b.cacheBits)
 }
 
 // ByteAlign aligns the buffer to byte boundary.
@@ -33,9 +114,8 @@ func (b *BitPackedBuff) ReadBits1() bool {
 	// No need to check endianness, we only need 1 bit (it can't be split in multiple bytes)
 
 	if b.cacheBits == 0 {
-		cache := b.contents[b.idx]
+		cache := b.nextByte()
 		b.cache = cache >> 1
-		b.idx++
 		b.cacheBits = 7
 		return cache&0x01 == 1
 	}
@@ -54,21 +134,18 @@ func (b *BitPackedBuff) ReadBits8() (r byte) {
 
 	if b.cacheBits == 0 {
 		// No need to check endianness, we need the next complete byte as-is
-		r = b.contents[b.idx]
-		b.idx++
+		r = b.nextByte()
 		return
 	}
 
 	compBits := 8 - b.cacheBits // complementary bits, bits needed from the next byte
 	if b.bigEndian {
 		r = b.cache << compBits // no need to mask, we need all cache bits
-		b.cache = b.contents[b.idx]
-		b.idx++
+		b.cache = b.nextByte()
 		r |= b.cache & bitMasks[compBits]
 	} else {
 		r = b.cache // no need to mask, we need all cache bits
-		b.cache = b.contents[b.idx]
-		b.idx++
+		b.cache = b.nextByte()
 		r |= (b.cache & bitMasks[compBits]) << b.cacheBits
 	}
 	b.cache >>= compBits
@@ -95,11 +172,9 @@ func (b *BitPackedBuff) ReadBits(n byte) int64 {
 	// Actually this is true 100% of the cases (little endian is only used to decode attributes events).
 	if n&0x07 == 0 && b.cacheBits == 0 {
 		// Remember: n > 0 (n == 0 is already handled)
-		value := int64(b.contents[b.idx])
-		b.idx++
+		value := int64(b.nextByte())
 		for i := byte(8); i < n; i += 8 {
-			value |= int64(b.contents[b.idx]) << i
-			b.idx++
+			value |= int64(b.nextByte()) << i
 		}
 		return value
 	}
@@ -116,12 +191,10 @@ func (b *BitPackedBuff) ReadBitsBigByte(n byte) (value int64) {
 
 	// Read whole bytes
 	for ; n > 8; n -= 8 {
-		value = (value << 8) | int64(b.contents[b.idx])
-		b.idx++
+		value = (value << 8) | int64(b.nextByte())
 	}
 
-	b.cache = b.contents[b.idx]
-	b.idx++
+	b.cache = b.nextByte()
 
 	compBits := 8 - b.cacheBits // complementary bits, bits needed from the last byte
 	value = (value << compBits) | int64(b.cache&bitMasks[compBits])
@@ -135,8 +208,7 @@ func (b *BitPackedBuff) ReadBitsBigByte(n byte) (value int64) {
 func (b *BitPackedBuff) ReadBitsBig(n byte) (value int64) {
 	for {
 		if b.cacheBits == 0 {
-			b.cache = b.contents[b.idx]
-			b.idx++
+			b.cache = b.nextByte()
 			b.cacheBits = 8
 		}
 
@@ -167,8 +239,7 @@ func (b *BitPackedBuff) ReadBitsLittle(n byte) (value int64) {
 	var valueBits byte // Bits already set in value
 	for {
 		if b.cacheBits == 0 {
-			b.cache = b.contents[b.idx]
-			b.idx++
+			b.cache = b.nextByte()
 			b.cacheBits = 8
 		}
 
@@ -195,13 +266,47 @@ func (b *BitPackedBuff) ReadBitsLittle(n byte) (value int64) {
 }
 
 // ReadAligned first aligns to a byte and reads and returns n bytes.
+// It panics with io.ErrUnexpectedEOF if there are less than n bytes left.
 func (b *BitPackedBuff) ReadAligned(n int) (buff []byte) {
+	buff, err := b.readAligned(n)
+	if err != nil {
+		panic(err)
+	}
+	return
+}
+
+// readAligned is ReadAligned that returns an error instead of panicking if there are less than n bytes left.
+func (b *BitPackedBuff) readAligned(n int) ([]byte, error) {
 	b.ByteAlign()
 
-	buff = make([]byte, n)
-	b.idx += copy(buff, b.contents[b.idx:])
+	if b.available(n) {
+		buff := make([]byte, n)
+		b.idx += copy(buff, b.contents[b.idx:])
+		return buff, nil
+	}
+	if b.src == nil || n <= cap(b.contents) {
+		return nil, b.errShort()
+	}
 
-	return
+	// Too large for the buffer: take what is buffered and read the rest from the source directly.
+	// The result grows as bytes arrive, so a crafted n does not allocate more than what the source holds.
+	buff := bytes.NewBuffer(append(make([]byte, 0, cap(b.contents)), b.contents[b.idx:]...))
+	b.base += int64(len(b.contents))
+	b.contents, b.idx = b.contents[:0], 0
+	if b.srcErr == nil {
+		k, err := buff.ReadFrom(io.LimitReader(b.src, int64(n-buff.Len())))
+		b.base += k
+		if err != nil {
+			b.srcErr = err
+		}
+	}
+	if buff.Len() < n {
+		if b.srcErr == nil {
+			b.srcErr = io.EOF
+		}
+		return nil, b.errShort()
+	}
+	return buff.Bytes(), nil
 }
 
 // ReadUnaligned reads and returns n bytes (or more precisely n*8 bits).
@@ -215,12 +320,11 @@ func (b *BitPackedBuff) ReadUnaligned(n int) (buff []byte) {
 	// then reading unaligned is the same as reading aligned which is much faster:
 	// no bit shift and masking is required, just copy the bytes
 	if b.cacheBits == 0 {
-		b.idx += copy(buff, b.contents[b.idx:])
-		return
+		return b.ReadAligned(n)
 	}
 
-	// Simplest / naive solution, fast(er) only if n is small:
-	if n <= 2 {
+	// Simplest / naive solution, fast(er) only if n is small (or if the bytes are yet to be read from the source):
+	if n <= 2 || !b.available(n) {
 		for i := range buff {
 			buff[i] = byte(b.ReadBits(8))
 		}
@@ -0,0 +1,100 @@
+// Implementation of a byte buffer that can be written by arbitrary number of bits.
+// This is the counterpart of BitPackedBuff: bits written by BitPackedWriter are read back the same by BitPackedBuff.
+
+package s2mdec
+
+// BitPackedWriter is the wrapper around a growing []byte providing writing by arbitrary number of bits.
+type BitPackedWriter struct {
+	contents  []byte // Written bytes, the last one might be partially filled
+	bigEndian bool   // Tells if numbers are written in big endian byte order.
+	usedBits  byte   // Used bits of the last byte, 0 if the next bit goes to a new byte
+}
+
+// NewBitPackedWriter creates a new bit-packed writer.
+func NewBitPackedWriter(bigEndian bool) *BitPackedWriter {
+	return &BitPackedWriter{bigEndian: bigEndian}
+}
+
+// Bytes returns the written bytes. Unused bits of the last byte are zeros.
+func (w *BitPackedWriter) Bytes() []byte {
+	return w.contents
+}
+
+// Len returns the number of bytes written, including the last partially filled byte.
+func (w *BitPackedWriter) Len() int {
+	return len(w.contents)
+}
+
+// ByteAlign aligns the buffer to byte boundary.
+// This means if there are unused bits in the last written byte, they are left zero.
+func (w *BitPackedWriter) ByteAlign() {
+	w.usedBits = 0
+}
+
+// WriteBits1 writes 1 bit, 1 if v is true and 0 otherwise.
+func (w *BitPackedWriter) WriteBits1(v bool) {
+	if v {
+		w.WriteBits(1, 1)
+	} else {
+		w.WriteBits(0, 1)
+	}
+}
+
+// WriteBits8 writes 8 bits.
+// This method is more efficient than but has the same effect as WriteBits(int64(v), 8).
+func (w *BitPackedWriter) WriteBits8(v byte) {
+	if w.usedBits == 0 {
+		// No need to check endianness, we write the next complete byte as-is
+		w.contents = append(w.contents, v)
+		return
+	}
+	w.WriteBits(int64(v), 8)
+}
+
+// WriteBits writes the lowest n bits of value.
+func (w *BitPackedWriter) WriteBits(value int64, n byte) {
+	for n > 0 {
+		if w.usedBits == 0 {
+			w.contents = append(w.contents, 0)
+		}
+
+		// How many bits fit into the last byte?
+		k := 8 - w.usedBits
+		if n < k {
+			k = n
+		}
+
+		var chunk byte
+		if w.bigEndian {
+			// Highest bits of value come first
+			chunk = byte(value>>(n-k)) & bitMasks[k]
+		} else {
+			// Lowest bits of value come first
+			chunk = byte(value) & bitMasks[k]
+			value >>= k
+		}
+		w.contents[len(w.contents)-1] |= chunk << w.usedBits
+
+		n -= k
+		if w.usedBits += k; w.usedBits == 8 {
+			w.usedBits = 0
+		}
+	}
+}
+
+// WriteAligned first aligns to a byte and writes the bytes of data.
+func (w *BitPackedWriter) WriteAligned(data []byte) {
+	w.ByteAlign()
+	w.contents = append(w.contents, data...)
+}
+
+// WriteUnaligned writes the bytes of data (or more precisely len(data)*8 bits).
+func (w *BitPackedWriter) WriteUnaligned(data []byte) {
+	if w.usedBits == 0 {
+		w.contents = append(w.contents, data...)
+		return
+	}
+	for _, v := range data {
+		w.WriteBits(int64(v), 8)
+	}
+}
@@ -0,0 +1,148 @@
+// Index of the Battle.net cache directory.
+
+package s2mdec
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Cache is an index of the files of a Battle.net cache directory by hash and type.
+// Files are laid out in two levels of directories named by the first two pairs of hex digits of their hashes,
+// e.g. "39/68/396811b3....s2mh", files out of this layout being ignored. The type of files without extension
+// is told by Detect, those of unknown format being ignored.
+type Cache struct {
+	Dir   string      // Root of the cache directory
+	Files []CacheFile // Indexed files sorted by hash and type
+
+	byLink map[cacheKey]string // Path of each file
+}
+
+// CacheFile is a file of the Battle.net cache.
+type CacheFile struct {
+	Hash string `json:"hash"` // Lower case hex encoded hash
+	Type string `json:"type"` // Lower case file extension without the dot, e.g. "s2mh"
+	Path string `json:"path"`
+}
+
+// cacheKey identifies a file of the cache.
+type cacheKey struct {
+	hash, typ string
+}
+
+// OpenCache walks the Battle.net cache directory dir and indexes its files.
+// Files and subdirectories which cannot be read are skipped.
+func OpenCache(dir string) (*Cache, error) {
+	c := &Cache{Dir: dir, byLink: map[cacheKey]string{}}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if path == dir {
+				return err
+			}
+			return nil // skipped
+		}
+		if info.IsDir() {
+			return nil
+		}
+		f, ok := cacheFileOf(dir, path)
+		if !ok {
+			return nil
+		}
+		if f.Type == "" {
+			if f.Type, ok = detectFileType(path); !ok {
+				return nil
+			}
+		}
+		c.Files = append(c.Files, f)
+		c.byLink[cacheKey{f.Hash, f.Type}] = f.Path
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(c.Files, func(i, j int) bool {
+		if c.Files[i].Hash != c.Files[j].Hash {
+			return c.Files[i].Hash < c.Files[j].Hash
+		}
+		return c.Files[i].Type < c.Files[j].Type
+	})
+	return c, nil
+}
+
+// cacheFileOf returns the file at path within the cache directory dir, or false if it is out of the layout.
+// The type of a file without extension is left empty.
+func cacheFileOf(dir, path string) (CacheFile, bool) {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return CacheFile{}, false
+	}
+	elems := strings.Split(filepath.ToSlash(rel), "/")
+	if len(elems) != 3 {
+		return CacheFile{}, false
+	}
+	name := elems[2]
+	ext := filepath.Ext(name)
+	hash := strings.ToLower(strings.TrimSuffix(name, ext))
+	if _, err := hex.DecodeString(hash); err != nil || len(hash) < 4 {
+		return CacheFile{}, false
+	}
+	if strings.ToLower(elems[0]) != hash[:2] || strings.ToLower(elems[1]) != hash[2:4] {
+		return CacheFile{}, false
+	}
+	return CacheFile{Hash: hash, Type: strings.ToLower(strings.TrimPrefix(ext, ".")), Path: path}, true
+}
+
+// detectFileType returns the type of the file at path told by Detect, or false if it cannot be read or is of unknown format.
+func detectFileType(path string) (string, bool) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", false
+	}
+	format, err := Detect(data)
+	if err != nil {
+		return "", false
+	}
+	return format.String(), true
+}
+
+// Path returns the path of the file of the hash and type, or false if it is not in the cache.
+func (c *Cache) Path(hash, typ string) (string, bool) {
+	path, ok := c.byLink[cacheKey{strings.ToLower(hash), strings.ToLower(typ)}]
+	return path, ok
+}
+
+// Resolve returns the path of the file link refers to, or false if it is not in the cache.
+func (c *Cache) Resolve(link DepotLink) (string, bool) {
+	return c.Path(link.Hash, link.Type)
+}
+
+// MapHeaderFiles are the paths of the files a map header refers to, empty for the files not in the cache.
+type MapHeaderFiles struct {
+	Archive      string              `json:"archive"`      // archiveHandle
+	StringTables map[string][]string `json:"stringTables"` // stringTable of each locale of localeTable
+	VisualFiles  []string            `json:"visualFiles"`  // visualFiles of workingSet
+}
+
+// ResolveMapHeader returns the paths of the files hdr refers to.
+func (c *Cache) ResolveMapHeader(hdr *MapHeader) *MapHeaderFiles {
+	files := &MapHeaderFiles{
+		StringTables: map[string][]string{},
+		VisualFiles:  make([]string, len(hdr.WorkingSet.VisualFiles)),
+	}
+	files.Archive, _ = c.Resolve(hdr.ArchiveHandle)
+	for _, l := range hdr.LocaleTable {
+		paths := make([]string, len(l.StringTable))
+		for i, link := range l.StringTable {
+			paths[i], _ = c.Resolve(link)
+		}
+		files.StringTables[l.Locale] = paths
+	}
+	for i, link := range hdr.WorkingSet.VisualFiles {
+		files.VisualFiles[i], _ = c.Resolve(link)
+	}
+	return files
+}
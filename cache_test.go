@@ -0,0 +1,84 @@
+package s2mdec
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCache(t *testing.T) {
+	dir := t.TempDir()
+	hash := func(b string) string {
+		return strings.Repeat(b, 32)
+	}
+	data, err := Marshal(testS2MH())
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	for name, content := range map[string][]byte{
+		"70/70/" + hash("70") + ".s2ma": nil,
+		"ab/ab/" + hash("ab") + ".s2ml": nil,
+		"AB/AB/" + hash("AB") + ".S2MV": nil,
+		"ab/cd/" + hash("ab") + ".s2mh": nil, // out of layout
+		"ab/ab/" + hash("zz") + ".s2mh": nil,
+		"ab/ab/" + hash("ab"):           nil, // of unknown format
+		"cd/cd/" + hash("cd"):           data,
+		"readme.txt":                    nil,
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+		if err := ioutil.WriteFile(path, content, 0644); err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+	}
+	c, err := OpenCache(dir)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if len(c.Files) != 4 || c.Files[0].Hash != hash("70") || c.Files[1].Type != "s2ml" || c.Files[2].Type != "s2mv" || c.Files[3].Type != "s2mh" {
+		t.Error("Unexpected value:", c.Files)
+	}
+	if path, ok := c.Path(hash("cd"), "s2mh"); !ok || path != filepath.Join(dir, "cd", "cd", hash("cd")) {
+		t.Error("Unexpected value:", path)
+	}
+	if path, ok := c.Path(strings.ToUpper(hash("ab")), "s2ml"); !ok || path != filepath.Join(dir, "ab", "ab", hash("ab")+".s2ml") {
+		t.Error("Unexpected value:", path)
+	}
+	if _, ok := c.Path(hash("ab"), "s2mh"); ok {
+		t.Error("Unexpected value!")
+	}
+
+	hdr, err := DecodeS2MH(data)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	files := c.ResolveMapHeader(hdr)
+	expected := &MapHeaderFiles{
+		Archive:      c.Files[0].Path,
+		StringTables: map[string][]string{"enUS": {c.Files[1].Path}, "deDE": {""}},
+		VisualFiles:  []string{c.Files[2].Path},
+	}
+	if !reflect.DeepEqual(files, expected) {
+		t.Error("Unexpected value:", files)
+	}
+
+	// Unreadable subdirectories are skipped, unless running as root which reads them anyway
+	if os.Geteuid() > 0 {
+		locked := filepath.Join(dir, "ef")
+		if err := os.Mkdir(locked, 0); err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+		defer os.Chmod(locked, 0755)
+		if c, err := OpenCache(dir); err != nil || len(c.Files) != 4 {
+			t.Error("Unexpected error:", err)
+		}
+	}
+	if _, err := OpenCache(filepath.Join(dir, "missing")); err == nil {
+		t.Error("Expected error for missing directory!")
+	}
+}
@@ -1,8 +1,8 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
-	"compress/zlib"
 	"encoding/json"
 	"errors"
 	"flag"
@@ -21,15 +21,31 @@ import (
 var args []string // non-flag args
 var bFlagCompact bool
 var bFlagUnlabeled bool
+var bFlagLenient bool
+var bFlagStrict bool
 
 func init() {
 	flag.BoolVar(&bFlagCompact, "c", false, "Compact: print out json without indentations")
-	flag.BoolVar(&bFlagUnlabeled, "u", false, "Unlabeled: print out json labeled with numbers instead of each field's respective name (applies only to s2mi and s2mh files)")
+	flag.BoolVar(&bFlagUnlabeled, "u", false, "Unlabeled: print out json labeled with numbers instead of each field's respective name (applies only to s2mi, s2mh and s2gs files, and to trace)")
+	flag.BoolVar(&bFlagLenient, "l", false, "Lenient: label s2mi and s2mh files, and the map structs of s2gs files such as the working set, of unknown versions with every known field instead of failing, printing out warnings to stderr")
+	flag.BoolVar(&bFlagStrict, "s", false, "Strict: fail on unexpected values of s2mi, s2mh and s2gs files instead of printing out warnings to stderr")
 	flag.Parse()
 	args = flag.Args()
 }
 
 func run() error {
+	// trace
+	if len(args) > 0 && args[0] == "trace" {
+		return runTrace(args[1:])
+	}
+	// cache
+	if len(args) > 0 && args[0] == "cache" {
+		return runCache(args[1:])
+	}
+	// schema
+	if len(args) == 1 && args[0] == "schema" {
+		return writeJSON(os.Stdout, s2mdec.Schemas, !bFlagCompact)
+	}
 	// len args
 	switch len(args) {
 	case 1: // decode a single file
@@ -39,25 +55,25 @@ func run() error {
 			return errFileIn
 		}
 		defer fileIn.Close()
-		// dataIn
-		dataIn, errDataIn := ioutil.ReadAll(fileIn)
-		if errDataIn != nil {
-			return errDataIn
+		// ext
+		ext, errExt := fileExt(fileIn)
+		if errExt != nil {
+			return errExt
 		}
 		// switch ext
-		switch ext := strings.ToLower(filepath.Ext(fileIn.Name())); ext {
+		switch ext {
 		case ".s2mi":
 			// unlabeled
-			unlabeled, ok := s2mdec.NewVersionedDec(dataIn).ReadStruct().(s2prot.Struct)
-			if !ok {
-				return errors.New("invalid s2mi")
+			unlabeled, errUnlabeled := readStruct(fileIn)
+			if errUnlabeled != nil {
+				return fmt.Errorf("s2mi: %v", errUnlabeled)
 			}
 			// bFlagUnlabeled
-			var output s2prot.Struct
+			var output interface{}
 			if bFlagUnlabeled {
 				output = unlabeled
 			} else {
-				labeled, errLabeled := s2mdec.ReadS2MI(unlabeled)
+				labeled, errLabeled := readS2MI(unlabeled.Struct())
 				if errLabeled != nil {
 					return fmt.Errorf("s2mi: %v", errLabeled)
 				}
@@ -70,16 +86,16 @@ func run() error {
 			return nil
 		case ".s2mh":
 			// unlabeled
-			unlabeled, ok := s2mdec.NewVersionedDec(dataIn).ReadStruct().(s2prot.Struct)
-			if !ok {
-				return errors.New("invalid s2mh")
+			unlabeled, errUnlabeled := readStruct(fileIn)
+			if errUnlabeled != nil {
+				return fmt.Errorf("s2mh: %v", errUnlabeled)
 			}
 			// bFlagUnlabeled
-			var output s2prot.Struct
+			var output interface{}
 			if bFlagUnlabeled {
 				output = unlabeled
 			} else {
-				labeled, errLabeled := s2mdec.ReadS2MH(unlabeled)
+				labeled, errLabeled := readS2MH(unlabeled.Struct())
 				if errLabeled != nil {
 					return fmt.Errorf("s2mh: %v", errLabeled)
 				}
@@ -91,6 +107,11 @@ func run() error {
 			}
 			return nil
 		case ".s2ml":
+			// dataIn
+			dataIn, errDataIn := ioutil.ReadAll(fileIn)
+			if errDataIn != nil {
+				return errDataIn
+			}
 			// translation
 			translation, errTranslation := s2mdec.ReadS2ML(dataIn)
 			if errTranslation != nil {
@@ -102,28 +123,30 @@ func run() error {
 			}
 			return nil
 		case ".s2gs":
-			// zlib
-			rZlib, errZlib := zlib.NewReader(bytes.NewReader(dataIn[16:]))
-			if errZlib != nil {
-				return fmt.Errorf("s2gs: %v", errZlib)
-			}
-			defer rZlib.Close()
-			// dataIn2
-			dataIn2, errDataIn2 := ioutil.ReadAll(rZlib)
-			if errDataIn2 != nil {
-				return fmt.Errorf("s2gs: %v", errDataIn2)
-			}
-			// unlabeled
-			unlabeled, ok := s2mdec.NewVersionedDec(dataIn2).ReadStruct().(s2prot.Struct)
-			if !ok {
-				return errors.New("invalid s2gs")
+			// sections
+			s2gs, errS2GS := readS2GSFile(fileIn)
+			if errS2GS != nil {
+				return errS2GS
 			}
 			// bFlagUnlabeled
-			var output s2prot.Struct
+			var output interface{}
 			if bFlagUnlabeled {
+				var unlabeled []s2mdec.OrderedStruct
+				for _, section := range s2gs.Sections {
+					instances, errUnlabeled := readStructs(bytes.NewReader(section.Data))
+					if errUnlabeled != nil {
+						return fmt.Errorf("s2gs: %v", errUnlabeled)
+					}
+					unlabeled = append(unlabeled, instances...)
+				}
 				output = unlabeled
 			} else {
-				output = unlabeled // not supported yet
+				labeled, warnings, errLabeled := (&s2mdec.Labeler{Lenient: bFlagLenient, Strict: bFlagStrict}).ReadS2GS(s2gs.Instances())
+				logWarnings(warnings)
+				if errLabeled != nil {
+					return fmt.Errorf("s2gs: %v", errLabeled)
+				}
+				output = labeled
 			}
 			// bFlagCompact
 			if errJSON := writeJSON(os.Stdout, output, !bFlagCompact); errJSON != nil {
@@ -132,9 +155,9 @@ func run() error {
 			return nil
 		default:
 			// unlabeled
-			unlabeled, ok := s2mdec.NewVersionedDec(dataIn).ReadStruct().(s2prot.Struct)
-			if !ok {
-				return fmt.Errorf("Unsupported file extension: %v", ext)
+			unlabeled, errUnlabeled := readStruct(fileIn)
+			if errUnlabeled != nil {
+				return fmt.Errorf("Unsupported file extension: %v: %v", ext, errUnlabeled)
 			}
 			// bFlagCompact
 			if errJSON := writeJSON(os.Stdout, unlabeled, !bFlagCompact); errJSON != nil {
@@ -145,7 +168,6 @@ func run() error {
 	case 2: // merging two files s2mh and s2ml
 		const nFiles = 2
 		fileIn := make([]*os.File, nFiles)
-		dataIn := make([][]byte, nFiles)
 		for i := 0; i < nFiles; i++ {
 			// fileIn
 			var errFileIn error
@@ -154,24 +176,22 @@ func run() error {
 				return errFileIn
 			}
 			defer fileIn[i].Close()
-			// dataIn
-			var errDataIn error
-			dataIn[i], errDataIn = ioutil.ReadAll(fileIn[i])
-			if errDataIn != nil {
-				return errDataIn
-			}
 		}
 		// prepare
 		s2mh, s2ml := s2prot.Struct(nil), s2mdec.MapLocale(nil)
 		// switch ext s2mh
-		switch ext := strings.ToLower(filepath.Ext(fileIn[0].Name())); ext {
+		ext, errExt := fileExt(fileIn[0])
+		if errExt != nil {
+			return errExt
+		}
+		switch ext {
 		case ".s2mh":
-			unlabeled, ok := s2mdec.NewVersionedDec(dataIn[0]).ReadStruct().(s2prot.Struct)
-			if !ok {
-				return errors.New("invalid s2mh")
+			unlabeled, errUnlabeled := readStruct(fileIn[0])
+			if errUnlabeled != nil {
+				return fmt.Errorf("s2mh: %v", errUnlabeled)
 			}
 			var errS2MH error
-			s2mh, errS2MH = s2mdec.ReadS2MH(unlabeled)
+			s2mh, errS2MH = readS2MH(unlabeled.Struct())
 			if errS2MH != nil {
 				return fmt.Errorf("s2mh: %v", errS2MH)
 			}
@@ -179,10 +199,17 @@ func run() error {
 			return fmt.Errorf("Unsupported file extension: %v", ext)
 		}
 		// switch ext s2ml
-		switch ext := strings.ToLower(filepath.Ext(fileIn[1].Name())); ext {
+		if ext, errExt = fileExt(fileIn[1]); errExt != nil {
+			return errExt
+		}
+		switch ext {
 		case ".s2ml":
+			dataIn, errDataIn := ioutil.ReadAll(fileIn[1])
+			if errDataIn != nil {
+				return errDataIn
+			}
 			var errS2ML error
-			s2ml, errS2ML = s2mdec.ReadS2ML(dataIn[1])
+			s2ml, errS2ML = s2mdec.ReadS2ML(dataIn)
 			if errS2ML != nil {
 				return fmt.Errorf("s2ml: %v", errS2ML)
 			}
@@ -204,6 +231,167 @@ func run() error {
 	}
 }
 
+// runTrace writes the annotated dump of a single file.
+func runTrace(args []string) error {
+	if len(args) != 1 {
+		return errors.New("Invalid argument")
+	}
+	// fileIn
+	fileIn, errFileIn := os.Open(args[0])
+	if errFileIn != nil {
+		return errFileIn
+	}
+	defer fileIn.Close()
+	// ext
+	ext, errExt := fileExt(fileIn)
+	if errExt != nil {
+		return errExt
+	}
+	// switch ext
+	var rIn io.Reader = fileIn
+	var names s2mdec.FieldNames
+	switch ext {
+	case ".s2mi":
+		names = s2mdec.S2MIFieldNames
+	case ".s2mh":
+		names = s2mdec.S2MHFieldNames
+	case ".s2gs":
+		// sections, the first one is traced
+		s2gs, errS2GS := readS2GSFile(fileIn)
+		if errS2GS != nil {
+			return errS2GS
+		}
+		rIn = bytes.NewReader(s2gs.Sections[0].Data)
+	}
+	// bFlagUnlabeled
+	if bFlagUnlabeled {
+		names = nil
+	}
+	// dataIn
+	dataIn, errDataIn := ioutil.ReadAll(rIn)
+	if errDataIn != nil {
+		return errDataIn
+	}
+	// trace
+	w := bufio.NewWriter(os.Stdout)
+	errTrace := s2mdec.NewVersionedDec(dataIn).Trace(w, names)
+	if errFlush := w.Flush(); errTrace == nil {
+		errTrace = errFlush
+	}
+	return errTrace
+}
+
+// runCache writes the index of a Battle.net cache directory,
+// or the paths of the files in it which an s2mh file refers to.
+func runCache(args []string) error {
+	if len(args) != 1 && len(args) != 2 {
+		return errors.New("Invalid argument")
+	}
+	cache, errCache := s2mdec.OpenCache(args[0])
+	if errCache != nil {
+		return errCache
+	}
+	if len(args) == 1 {
+		return writeJSON(os.Stdout, cache.Files, !bFlagCompact)
+	}
+	// s2mh
+	dataIn, errDataIn := ioutil.ReadFile(args[1])
+	if errDataIn != nil {
+		return errDataIn
+	}
+	hdr, errHdr := s2mdec.DecodeS2MH(dataIn)
+	if errHdr != nil {
+		return fmt.Errorf("s2mh: %v", errHdr)
+	}
+	return writeJSON(os.Stdout, cache.ResolveMapHeader(hdr), !bFlagCompact)
+}
+
+// fileExt returns the lower case extension of the name of f. If it is not the one of a known format,
+// e.g. for cache files named by hash only, the extension of the format told by s2mdec.Detect is returned instead.
+func fileExt(f *os.File) (string, error) {
+	ext := strings.ToLower(filepath.Ext(f.Name()))
+	switch ext {
+	case ".s2mi", ".s2mh", ".s2ml", ".s2gs":
+		return ext, nil
+	}
+	// detect
+	dataIn, errDataIn := ioutil.ReadAll(f)
+	if errDataIn != nil {
+		return "", errDataIn
+	}
+	if _, errSeek := f.Seek(0, io.SeekStart); errSeek != nil {
+		return "", errSeek
+	}
+	if format, errFormat := s2mdec.Detect(dataIn); errFormat == nil {
+		return "." + format.String(), nil
+	}
+	return ext, nil
+}
+
+// readStruct decodes the instance read from r which is expected to be a struct.
+// Fields are kept in wire order so that unlabeled output follows the file.
+func readStruct(r io.Reader) (s2mdec.OrderedStruct, error) {
+	dec := s2mdec.NewVersionedDecReader(r)
+	dec.OrderedStructs = true
+	v, err := dec.Decode()
+	if err != nil {
+		return nil, err
+	}
+	unlabeled, ok := v.(s2mdec.OrderedStruct)
+	if !ok {
+		return nil, errors.New("invalid struct")
+	}
+	return unlabeled, nil
+}
+
+// readStructs decodes the instances read from r until its end, each of them expected to be a struct.
+func readStructs(r io.Reader) ([]s2mdec.OrderedStruct, error) {
+	dec := s2mdec.NewVersionedDecReader(r)
+	dec.OrderedStructs = true
+	var unlabeled []s2mdec.OrderedStruct
+	for !dec.EOF() {
+		v, err := dec.Decode()
+		if err != nil {
+			return nil, err
+		}
+		part, ok := v.(s2mdec.OrderedStruct)
+		if !ok {
+			return nil, errors.New("invalid struct")
+		}
+		unlabeled = append(unlabeled, part)
+	}
+	return unlabeled, nil
+}
+
+// readS2GSFile reads the container of the s2gs file read from r.
+func readS2GSFile(r io.Reader) (*s2mdec.S2GSFile, error) {
+	dataIn, errDataIn := ioutil.ReadAll(r)
+	if errDataIn != nil {
+		return nil, errDataIn
+	}
+	return s2mdec.ReadS2GSFile(dataIn)
+}
+
+// readS2MI labels s2mi as told by the flags and logs the warnings.
+func readS2MI(unlabeled s2prot.Struct) (s2prot.Struct, error) {
+	labeled, warnings, err := (&s2mdec.Labeler{Lenient: bFlagLenient, Strict: bFlagStrict}).ReadS2MI(unlabeled)
+	logWarnings(warnings)
+	return labeled, err
+}
+
+// readS2MH labels s2mh as told by the flags and logs the warnings.
+func readS2MH(unlabeled s2prot.Struct) (s2prot.Struct, error) {
+	labeled, warnings, err := (&s2mdec.Labeler{Lenient: bFlagLenient, Strict: bFlagStrict}).ReadS2MH(unlabeled)
+	logWarnings(warnings)
+	return labeled, err
+}
+
+func logWarnings(warnings []s2mdec.Warning) {
+	for _, w := range warnings {
+		log.Println("warning:", w)
+	}
+}
+
 func writeJSON(w io.Writer, v interface{}, indent bool) error {
 	enc := json.NewEncoder(w)
 	enc.SetEscapeHTML(false)
@@ -0,0 +1,308 @@
+// Implementation of extracting selected instances from the versioned format.
+
+package s2mdec
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/icza/s2prot"
+)
+
+// Paths is a compiled set of paths to extract, see CompilePaths.
+type Paths struct {
+	root  *pathNode
+	paths []string
+}
+
+// pathNode is a node of the trie of the compiled paths.
+type pathNode struct {
+	index    int                 // Index of the path ending at this node, -1 if none
+	children map[int64]*pathNode // Nodes of the struct field tags and array indices continuing the paths
+}
+
+// CompilePaths compiles paths to be extracted by ExtractPaths.
+// A path is a dot separated list of struct field tags and array indices, e.g. "0.0.13",
+// the empty path selects the whole instance. Choices and optionals are transparent, they are not part of paths.
+func CompilePaths(paths ...string) (*Paths, error) {
+	p := &Paths{root: &pathNode{index: -1}, paths: paths}
+	for i, path := range paths {
+		n := p.root
+		if path != "" {
+			for _, elem := range strings.Split(path, ".") {
+				key, err := strconv.ParseInt(elem, 10, 64)
+				if err != nil || key < 0 {
+					return nil, fmt.Errorf("invalid path: %q", path)
+				}
+				if n.children == nil {
+					n.children = map[int64]*pathNode{}
+				}
+				child := n.children[key]
+				if child == nil {
+					child = &pathNode{index: -1}
+					n.children[key] = child
+				}
+				n = child
+			}
+		}
+		if n.index >= 0 {
+			return nil, fmt.Errorf("duplicate path: %q", path)
+		}
+		n.index = i
+	}
+	return p, nil
+}
+
+// String returns the paths separated by commas.
+func (p *Paths) String() string {
+	return strings.Join(p.paths, ",")
+}
+
+// Extract compiles paths and extracts them from the next instance, see ExtractPaths.
+func (d *VersionedDec) Extract(paths ...string) ([]interface{}, error) {
+	p, err := CompilePaths(paths...)
+	if err != nil {
+		return nil, err
+	}
+	return d.ExtractPaths(p)
+}
+
+// ExtractPaths reads the next instance and returns the instances at paths in the order of the paths,
+// in the same representation as ReadStruct does, or nil if the path is not present.
+// Subtrees not selected by any path are skipped without decoding them.
+func (d *VersionedDec) ExtractPaths(p *Paths) ([]interface{}, error) {
+	results := make([]interface{}, len(p.paths))
+	if err := d.extract(p.root, results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// extract reads the next instance and stores the instances selected by n into results.
+func (d *VersionedDec) extract(n *pathNode, results []interface{}) error {
+	if n.index >= 0 {
+		v, err := d.decode()
+		if err != nil {
+			return err
+		}
+		n.fill(v, results)
+		return nil
+	}
+
+	t, err := d.readBits8()
+	if err != nil {
+		return d.newDecodeError(-1, err)
+	}
+	dataType := DataType(t)
+	if err := d.enter(); err != nil {
+		return d.newDecodeError(dataType, err)
+	}
+	defer d.leave()
+
+	switch dataType {
+	case DataTypeArray:
+		length, err := d.readLength()
+		if err != nil {
+			return d.newDecodeError(dataType, err)
+		}
+		for i := 0; i < length; i++ {
+			if child := n.children[int64(i)]; child != nil {
+				err = d.extract(child, results)
+			} else {
+				err = d.skip()
+			}
+			if err != nil {
+				return prependPath(err, strconv.Itoa(i))
+			}
+		}
+		return nil
+	case DataTypeChoice:
+		if _, err := d.readVarInt(); err != nil { // tag
+			return d.newDecodeError(dataType, err)
+		}
+		return d.extract(n, results)
+	case DataTypeOptional:
+		exists, err := d.readBits8()
+		if err != nil {
+			return d.newDecodeError(dataType, err)
+		}
+		if exists != 0 {
+			return d.extract(n, results)
+		}
+		return nil
+	case DataTypeStruct:
+		nEntries, err := d.readLength()
+		if err != nil {
+			return d.newDecodeError(dataType, err)
+		}
+		for i := 0; i < nEntries; i++ {
+			tag, err := d.readVarInt()
+			if err != nil {
+				return d.newDecodeError(dataType, err)
+			}
+			if child := n.children[tag]; child != nil {
+				err = d.extract(child, results)
+			} else {
+				err = d.skip()
+			}
+			if err != nil {
+				return prependPath(err, strconv.FormatInt(tag, 10))
+			}
+		}
+		return nil
+	}
+	return d.skipValue(dataType)
+}
+
+// fill stores v and its descendants selected by n into results.
+func (n *pathNode) fill(v interface{}, results []interface{}) {
+	if n.index >= 0 {
+		results[n.index] = v
+	}
+	for key, child := range n.children {
+		if cv, ok := childValue(v, key); ok {
+			child.fill(cv, results)
+		}
+	}
+}
+
+// childValue returns the struct field or array element of v identified by key.
+func childValue(v interface{}, key int64) (interface{}, bool) {
+	switch v := v.(type) {
+	case s2prot.Struct:
+		cv, ok := v[strconv.FormatInt(key, 10)]
+		return cv, ok
+	case OrderedStruct:
+		return v.Field(key)
+	case []interface{}:
+		if key < int64(len(v)) {
+			return v[key], true
+		}
+	}
+	return nil, false
+}
+
+// SkipInstance reads and discards an instance whose type is deducted from the read Field type.
+// SkipInstance panics with a *DecodeError if the input is truncated or malformed, or exceeds DefaultLimits.
+func (b *BitPackedBuff) SkipInstance() {
+	if err := (&VersionedDec{BitPackedBuff: b, Limits: DefaultLimits}).skip(); err != nil {
+		panic(err)
+	}
+}
+
+// skip reads and discards the next instance.
+func (d *VersionedDec) skip() error {
+	t, err := d.readBits8()
+	if err != nil {
+		return d.newDecodeError(-1, err)
+	}
+	dataType := DataType(t)
+	if err := d.enter(); err != nil {
+		return d.newDecodeError(dataType, err)
+	}
+	defer d.leave()
+	return d.skipValue(dataType)
+}
+
+// skipValue reads and discards an instance of dataType whose type identifier is already read.
+func (d *VersionedDec) skipValue(dataType DataType) error {
+	start := d.bitOffset() - 8 // of the type identifier
+	switch dataType {
+	case DataTypeArray:
+		length, err := d.readLength()
+		if err != nil {
+			return d.newDecodeError(dataType, err)
+		}
+		for i := 0; i < length; i++ {
+			if err := d.skip(); err != nil {
+				return prependPath(err, strconv.Itoa(i))
+			}
+		}
+		return nil
+	case DataTypeBitArray:
+		length, err := d.readLength()
+		if err == nil {
+			err = d.skipAligned(bitArrayBytes(length))
+		}
+		if err != nil {
+			return d.newDecodeError(dataType, err)
+		}
+		return nil
+	case DataTypeBlob:
+		length, err := d.readLength()
+		if err == nil {
+			err = d.skipAligned(length)
+		}
+		if err != nil {
+			return d.newDecodeError(dataType, err)
+		}
+		return nil
+	case DataTypeChoice:
+		if _, err := d.readVarInt(); err != nil { // tag
+			return d.newDecodeError(dataType, err)
+		}
+		return d.skip()
+	case DataTypeOptional:
+		exists, err := d.readBits8()
+		if err != nil {
+			return d.newDecodeError(dataType, err)
+		}
+		if exists != 0 {
+			return d.skip()
+		}
+		return nil
+	case DataTypeStruct:
+		nEntries, err := d.readLength()
+		if err != nil {
+			return d.newDecodeError(dataType, err)
+		}
+		for i := 0; i < nEntries; i++ {
+			tag, err := d.readVarInt()
+			if err != nil {
+				return d.newDecodeError(dataType, err)
+			}
+			if err := d.skip(); err != nil {
+				return prependPath(err, strconv.FormatInt(tag, 10))
+			}
+		}
+		return nil
+	case DataTypeUint8:
+		if _, err := d.readBits8(); err != nil {
+			return d.newDecodeError(dataType, err)
+		}
+		return nil
+	case DataTypeUint32, DataTypeUint64:
+		n := 4
+		if dataType == DataTypeUint64 {
+			n = 8
+		}
+		if err := d.skipAligned(n); err != nil {
+			return d.newDecodeError(dataType, err)
+		}
+		return nil
+	case DataTypeVarInt:
+		if _, err := d.readVarInt(); err != nil {
+			return d.newDecodeError(dataType, err)
+		}
+		return nil
+	}
+	return &DecodeError{Offset: start / 8, Bit: start, DataType: dataType, Err: errUnknownDataType}
+}
+
+// skipAligned first aligns to a byte and discards n bytes without allocating them.
+func (b *BitPackedBuff) skipAligned(n int) error {
+	b.ByteAlign()
+	for n > 0 {
+		if !b.available(1) {
+			return b.errShort()
+		}
+		k := len(b.contents) - b.idx
+		if k > n {
+			k = n
+		}
+		b.idx += k
+		n -= k
+	}
+	return nil
+}
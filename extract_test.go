@@ -0,0 +1,80 @@
+package s2mdec
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/icza/s2prot"
+)
+
+func TestExtract(t *testing.T) {
+	data, err := Marshal(testS2MH())
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	vs, err := NewVersionedDec(data).Extract("0.0.0", "0.18", "0.0", "0.13.0.15.1", "0.99", "0.13.5")
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if vs[0] != int64(289177) || !reflect.DeepEqual(vs[1], []interface{}{"BLIZ", "FEAT"}) {
+		t.Error("Unexpected value!")
+	}
+	if !reflect.DeepEqual(vs[2], s2prot.Struct{"0": int64(289177), "1": int64(65568)}) {
+		t.Error("Unexpected value!")
+	}
+	if !reflect.DeepEqual(vs[3], testLocKey(13)) || vs[4] != nil || vs[5] != nil {
+		t.Error("Unexpected value!")
+	}
+
+	// Choices and optionals are transparent
+	val := &Value{Type: DataTypeStruct, Fields: []ValueField{
+		{Tag: 0, Value: &Value{Type: DataTypeBlob, Bytes: []byte("skipped")}},
+		{Tag: 1, Value: &Value{Type: DataTypeOptional, Elem: &Value{Type: DataTypeChoice, Tag: 2, Elem: &Value{
+			Type: DataTypeArray, Elems: []*Value{{Type: DataTypeVarInt, Int: 1}, {Type: DataTypeVarInt, Int: -2}},
+		}}}},
+	}}
+	if data, err = EncodeValue(val); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if vs, err = NewVersionedDec(data).Extract("1.1"); err != nil || vs[0] != int64(-2) {
+		t.Error("Unexpected value:", vs, err)
+	}
+	if _, err = NewVersionedDec(data[:len(data)-1]).Extract("0"); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Error("Unexpected error:", err)
+	}
+
+	for _, path := range []string{"0.x", "0..1", "-1"} {
+		if _, err := CompilePaths(path); err == nil {
+			t.Error("Expected error for path:", path)
+		}
+	}
+}
+
+func TestSkipInstance(t *testing.T) {
+	data := append(append([]byte{}, testStructData...), 0x09, 0x0a)
+	dec := NewVersionedDec(data)
+	dec.SkipInstance()
+	if dec.ReadStruct() != int64(5) || !dec.EOF() {
+		t.Error("Unexpected value!")
+	}
+
+	func() {
+		defer func() {
+			if err, _ := recover().(error); !errors.Is(err, ErrLimitExceeded) {
+				t.Error("Unexpected panic:", err)
+			}
+		}()
+		deep := append(bytes.Repeat([]byte{0x04, 0x01}, 100), 0x09, 0x00)
+		NewVersionedDec(deep).SkipInstance()
+	}()
+
+	defer func() {
+		if _, ok := recover().(*DecodeError); !ok {
+			t.Error("Expected *DecodeError panic!")
+		}
+	}()
+	NewVersionedDec(testStructData[:5]).SkipInstance()
+}
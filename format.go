@@ -0,0 +1,94 @@
+// Detection of the format of Battle.net cache files.
+
+package s2mdec
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/beevik/etree"
+	"github.com/icza/s2prot"
+)
+
+// Format is the format of a Battle.net cache file, see Detect.
+type Format int
+
+// Formats told by Detect.
+const (
+	FormatUnknown Format = iota
+	FormatS2MH           // Map header, see ReadS2MH
+	FormatS2MI           // Map info, see ReadS2MI
+	FormatS2ML           // Map locale, see ReadS2ML
+	FormatS2GS           // Game summary, see ReadS2GSFile
+)
+
+// String returns the file extension of the format without the dot, e.g. "s2mh".
+func (f Format) String() string {
+	switch f {
+	case FormatS2MH:
+		return "s2mh"
+	case FormatS2MI:
+		return "s2mi"
+	case FormatS2ML:
+		return "s2ml"
+	case FormatS2GS:
+		return "s2gs"
+	}
+	return "unknown"
+}
+
+// ErrUnknownFormat is the cause of the error returned by Detect for data of none of the known formats.
+var ErrUnknownFormat = errors.New("unknown format")
+
+// Detect tells the format of data by its structure, regardless of the name of its file:
+// an XML document whose root is Locale is s2ml, a section header followed by a zlib stream is s2gs,
+// and a versioned struct wrapping a struct is s2mi if its field 1 links to an s2mh, or s2mh if its fields 1 and 2
+// are the filename and the archive link. Data of none of these is FormatUnknown with an error wrapping ErrUnknownFormat.
+func Detect(data []byte) (Format, error) {
+	if len(data) == 0 {
+		return FormatUnknown, fmt.Errorf("%w: empty data", ErrUnknownFormat)
+	}
+	// s2gs
+	if bytes.HasPrefix(data, []byte(S2GSMagic)) {
+		if len(data) < S2GSHeaderSize+2 || !isZlibHeader(data[S2GSHeaderSize], data[S2GSHeaderSize+1]) {
+			return FormatUnknown, fmt.Errorf("%w: no zlib stream after the s2gs header", ErrUnknownFormat)
+		}
+		return FormatS2GS, nil
+	}
+	// s2ml
+	if trimmed := bytes.TrimLeft(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")), " \t\r\n"); len(trimmed) > 0 && trimmed[0] == '<' {
+		doc := etree.NewDocument()
+		if err := doc.ReadFromBytes(data); err != nil {
+			return FormatUnknown, fmt.Errorf("%w: cannot parse xml: %v", ErrUnknownFormat, err)
+		}
+		if root := doc.Root(); root == nil || root.Tag != "Locale" {
+			return FormatUnknown, fmt.Errorf("%w: xml without root element Locale", ErrUnknownFormat)
+		}
+		return FormatS2ML, nil
+	}
+	// s2mh and s2mi
+	v, err := NewVersionedDec(data).Decode()
+	if err != nil {
+		return FormatUnknown, fmt.Errorf("%w: %v", ErrUnknownFormat, err)
+	}
+	wrapper, _ := v.(s2prot.Struct)
+	unlabeled := wrapper.Structv("0")
+	if _, errVer := verOf(unlabeled); len(wrapper) != 2 || errVer != nil {
+		return FormatUnknown, fmt.Errorf("%w: versioned instance of unknown layout", ErrUnknownFormat)
+	}
+	if link, ok := unlabeled["1"].(string); ok && len(link) > 8 && link[:4] == "s2mh" {
+		return FormatS2MI, nil
+	}
+	if _, ok := unlabeled["1"].(string); ok {
+		if link, ok := unlabeled["2"].(string); ok && len(link) > 8 {
+			return FormatS2MH, nil
+		}
+	}
+	return FormatUnknown, fmt.Errorf("%w: versioned struct of unknown fields", ErrUnknownFormat)
+}
+
+// isZlibHeader tells if cmf and flg are the first two bytes of a zlib stream using deflate.
+func isZlibHeader(cmf, flg byte) bool {
+	return cmf&0x0f == 8 && cmf>>4 <= 7 && (uint(cmf)<<8|uint(flg))%31 == 0
+}
@@ -0,0 +1,46 @@
+package s2mdec
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/icza/s2prot"
+)
+
+func TestDetect(t *testing.T) {
+	marshal := func(v interface{}) []byte {
+		data, err := Marshal(v)
+		if err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+		return data
+	}
+	cases := []struct {
+		name   string
+		data   []byte
+		format Format
+	}{
+		{"s2mh", marshal(testS2MH()), FormatS2MH},
+		{"s2mi", marshal(testS2MI()), FormatS2MI},
+		{"s2ml", []byte("\xef\xbb\xbf<?xml version=\"1.0\" encoding=\"utf-8\"?>\r\n<Locale region=\"enUS\">\r\n<e id=\"1\">Cold Voyage</e>\r\n</Locale>"), FormatS2ML},
+		{"s2gs", testS2GSSection(t, nil, testS2GS()...), FormatS2GS},
+		{"empty", nil, FormatUnknown},
+		{"xml", []byte("<Catalog></Catalog>"), FormatUnknown},
+		{"s2gs header", []byte("ZLib\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"), FormatUnknown},
+		{"struct", marshal(s2prot.Struct{"0": s2prot.Struct{"0": int64(1)}, "1": int64(0)}), FormatUnknown},
+		{"int", marshal(int64(1)), FormatUnknown},
+		{"junk", []byte{0xff, 0xff, 0xff}, FormatUnknown},
+	}
+	for _, c := range cases {
+		format, err := Detect(c.data)
+		if format != c.format {
+			t.Errorf("Unexpected format for %s: %v", c.name, format)
+		}
+		if (format == FormatUnknown) != errors.Is(err, ErrUnknownFormat) {
+			t.Errorf("Unexpected error for %s: %v", c.name, err)
+		}
+	}
+	if FormatS2GS.String() != "s2gs" || FormatUnknown.String() != "unknown" {
+		t.Error("Unexpected value!")
+	}
+}
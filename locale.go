@@ -0,0 +1,115 @@
+// Resolution of the s2ml files of an s2mh by its localeTable.
+
+package s2mdec
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/icza/s2prot"
+)
+
+// FileResolver returns the contents of the file link refers to.
+type FileResolver func(link DepotLink) ([]byte, error)
+
+// DirResolver returns a FileResolver reading the files from the directory dir,
+// either directly in it or laid out as in the Battle.net cache, see Cache.
+func DirResolver(dir string) FileResolver {
+	return func(link DepotLink) ([]byte, error) {
+		paths := []string{filepath.Join(dir, link.Filename())}
+		if len(link.Hash) >= 4 {
+			paths = append(paths, filepath.Join(dir, link.Hash[:2], link.Hash[2:4], link.Filename()))
+		}
+		for _, path := range paths {
+			data, err := ioutil.ReadFile(path)
+			if !os.IsNotExist(err) {
+				return data, err
+			}
+		}
+		return nil, fmt.Errorf("%s: %w", link.Filename(), os.ErrNotExist)
+	}
+}
+
+// Resolver returns a FileResolver reading the files from the cache.
+func (c *Cache) Resolver() FileResolver {
+	return func(link DepotLink) ([]byte, error) {
+		path, ok := c.Resolve(link)
+		if !ok {
+			return nil, fmt.Errorf("%s: %w", link.Filename(), os.ErrNotExist)
+		}
+		return ioutil.ReadFile(path)
+	}
+}
+
+// S2MHApplyLocale adds the translations of the first of locale and fallbacks found in the localeTable of s2mh
+// to s2mh, as S2MHApplyS2ML does, loading the s2ml files of its stringTable with resolve. Locales whose s2ml files
+// do not exist are skipped, strings missing from the s2ml files are taken from those of the next locales found,
+// in order. The locale whose translations were added is returned with s2mh.
+func S2MHApplyLocale(s2mhLabeled s2prot.Struct, locale string, fallbacks []string, resolve FileResolver) (s2prot.Struct, string, error) {
+	// localeTable
+	var localeTable []LocalizationLink
+	if err := fromLabeled(s2mhLabeled["localeTable"], &localeTable); err != nil {
+		return nil, "", fmt.Errorf("localeTable: %w", err)
+	}
+	stringTables := map[string][]DepotLink{}
+	for _, l := range localeTable {
+		stringTables[l.Locale] = append(stringTables[l.Locale], l.StringTable...)
+	}
+	// translation
+	translation := MapLocale{}
+	found := ""
+	var errNotExist error
+	for _, l := range append([]string{locale}, fallbacks...) {
+		links, ok := stringTables[l]
+		if !ok {
+			continue
+		}
+		s2mls, err := readS2MLs(links, resolve)
+		if errors.Is(err, os.ErrNotExist) {
+			errNotExist = fmt.Errorf("s2ml of %s: %w", l, err)
+			continue
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("s2ml of %s: %w", l, err)
+		}
+		if found == "" {
+			found = l
+		}
+		for _, s2ml := range s2mls {
+			for id, text := range s2ml {
+				if _, ok := translation[id]; !ok {
+					translation[id] = text
+				}
+			}
+		}
+	}
+	if found == "" {
+		if errNotExist != nil {
+			return nil, "", errNotExist
+		}
+		return nil, "", fmt.Errorf("none of %s and %v in localeTable", locale, fallbacks)
+	}
+	translated, err := S2MHApplyS2ML(s2mhLabeled, translation, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	return translated, found, nil
+}
+
+// readS2MLs reads the s2ml files links refer to with resolve.
+func readS2MLs(links []DepotLink, resolve FileResolver) ([]MapLocale, error) {
+	s2mls := make([]MapLocale, len(links))
+	for i, link := range links {
+		data, err := resolve(link)
+		if err != nil {
+			return nil, err
+		}
+		if s2mls[i], err = ReadS2ML(data); err != nil {
+			return nil, err
+		}
+	}
+	return s2mls, nil
+}
@@ -0,0 +1,73 @@
+package s2mdec
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/icza/s2prot"
+)
+
+func TestS2MHApplyLocale(t *testing.T) {
+	dir := t.TempDir()
+	enUS := filepath.Join(dir, "ab", "ab", strings.Repeat("ab", 32)+".s2ml")
+	deDE := filepath.Join(dir, strings.Repeat("cd", 32)+".s2ml")
+	if err := os.MkdirAll(filepath.Dir(enUS), 0755); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if err := ioutil.WriteFile(enUS, []byte(`<Locale><e id="1">Cold Voyage</e><e id="8">Category</e></Locale>`), 0644); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if err := ioutil.WriteFile(deDE, []byte(`<Locale><e id="1">Kalte Reise</e></Locale>`), 0644); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	labeled := func() s2prot.Struct {
+		unlabeled := testS2MH()
+		delete(unlabeled.Structv("0"), "19") // arcadeInfo
+		labeled, err := ReadS2MH(unlabeled)
+		if err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+		return labeled
+	}
+
+	translated, locale, err := S2MHApplyLocale(labeled(), "deDE", []string{"enUS"}, DirResolver(dir))
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	variant := translated["variants"].([]interface{})[0].(s2prot.Struct)
+	if locale != "deDE" || translated.Stringv("workingSet", "name") != "Kalte Reise" || variant["categoryName"] != "Category" {
+		t.Error("Unexpected value!")
+	}
+
+	c, err := OpenCache(dir)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	translated, locale, err = S2MHApplyLocale(labeled(), "frFR", []string{"enUS"}, c.Resolver())
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if locale != "enUS" || translated.Stringv("workingSet", "name") != "Cold Voyage" {
+		t.Error("Unexpected value!")
+	}
+
+	// deDE is out of the cache layout
+	translated, locale, err = S2MHApplyLocale(labeled(), "deDE", []string{"enUS"}, c.Resolver())
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	variant = translated["variants"].([]interface{})[0].(s2prot.Struct)
+	if locale != "enUS" || translated.Stringv("workingSet", "name") != "Cold Voyage" || variant["categoryName"] != "Category" {
+		t.Error("Unexpected value!")
+	}
+	if _, _, err := S2MHApplyLocale(labeled(), "deDE", nil, c.Resolver()); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Unexpected error:", err)
+	}
+	if _, _, err := S2MHApplyLocale(labeled(), "frFR", nil, DirResolver(dir)); err == nil {
+		t.Error("Expected error for missing locale!")
+	}
+}
@@ -0,0 +1,230 @@
+// Implementation of encoding tagged Go values into the versioned format.
+
+package s2mdec
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/icza/s2prot"
+)
+
+// Marshaler is implemented by types that encode themselves into a Value.
+type Marshaler interface {
+	MarshalS2M() (*Value, error)
+}
+
+var (
+	typeValuePtr      = reflect.TypeOf(&Value{})
+	typeOrderedStruct = reflect.TypeOf(OrderedStruct{})
+)
+
+// Marshal returns the versioned encoding of v.
+//
+// Marshal uses the same "s2m" struct tags as Unmarshal. Fields are written in declaration order,
+// fields with the "optional" option are omitted if they hold the zero value.
+//
+// Go types are written as the following wire types:
+//   - bool: DataTypeUint8
+//   - integer types: DataTypeVarInt
+//   - string and []byte: DataTypeBlob
+//   - [4]byte and [8]byte: DataTypeUint32 and DataTypeUint64 respectively, other byte arrays as DataTypeBlob
+//   - s2prot.BitArr: DataTypeBitArray
+//   - slices: DataTypeArray
+//   - structs and OrderedStruct: DataTypeStruct
+//   - maps with integer string keys such as s2prot.Struct: DataTypeStruct with fields in ascending tag order
+//   - pointers: DataTypeOptional, absent if nil
+//   - interfaces: as the value they hold, nil being an absent DataTypeOptional
+//   - Value: as is, a nil *Value being an absent DataTypeOptional
+//
+// If v itself is a pointer, the pointed value is written.
+func Marshal(v interface{}) ([]byte, error) {
+	val, err := MarshalValue(v)
+	if err != nil {
+		return nil, err
+	}
+	return EncodeValue(val)
+}
+
+// MarshalValue returns v as a Value, see Marshal.
+func MarshalValue(v interface{}) (*Value, error) {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		return nil, fmt.Errorf("marshal: nil value")
+	}
+	if rv.Kind() == reflect.Ptr && rv.Type() != typeValuePtr {
+		if rv.IsNil() {
+			return nil, fmt.Errorf("marshal: nil %T", v)
+		}
+		rv = rv.Elem()
+	}
+	return marshalValue(rv)
+}
+
+// marshalValue returns rv as a Value.
+func marshalValue(rv reflect.Value) (*Value, error) {
+	typeError := func(err error) error {
+		return &EncodeError{DataType: -1, Err: fmt.Errorf("%v: %v", rv.Type(), err)}
+	}
+
+	if m, ok := asMarshaler(rv); ok {
+		val, err := m.MarshalS2M()
+		if err != nil {
+			return nil, typeError(err)
+		}
+		return val, nil
+	}
+	switch rv.Type() {
+	case typeValue:
+		val := rv.Interface().(Value)
+		return &val, nil
+	case typeValuePtr:
+		if rv.IsNil() {
+			return &Value{Type: DataTypeOptional}, nil
+		}
+		return rv.Interface().(*Value), nil
+	case typeBitArr:
+		barr := rv.Interface().(s2prot.BitArr)
+		return &Value{Type: DataTypeBitArray, Bits: barr.Count, Bytes: barr.Data}, nil
+	case typeOrderedStruct:
+		val := &Value{Type: DataTypeStruct}
+		for _, f := range rv.Interface().(OrderedStruct) {
+			fv, err := marshalInterface(f.Value)
+			if err != nil {
+				return nil, prependEncodePath(err, strconv.FormatInt(f.Tag, 10))
+			}
+			val.Fields = append(val.Fields, ValueField{Tag: f.Tag, Value: fv})
+		}
+		return val, nil
+	}
+
+	switch rv.Kind() {
+	case reflect.Interface:
+		return marshalInterface(rv.Interface())
+	case reflect.Ptr:
+		val := &Value{Type: DataTypeOptional}
+		if !rv.IsNil() {
+			elem, err := marshalValue(rv.Elem())
+			if err != nil {
+				return nil, err
+			}
+			val.Elem = elem
+		}
+		return val, nil
+	case reflect.Bool:
+		val := &Value{Type: DataTypeUint8}
+		if rv.Bool() {
+			val.Int = 1
+		}
+		return val, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Value{Type: DataTypeVarInt, Int: rv.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if rv.Uint() > math.MaxInt64 {
+			return nil, typeError(errOutOfRange)
+		}
+		return &Value{Type: DataTypeVarInt, Int: int64(rv.Uint())}, nil
+	case reflect.String:
+		return &Value{Type: DataTypeBlob, Bytes: []byte(rv.String())}, nil
+	case reflect.Array:
+		if rv.Type().Elem().Kind() != reflect.Uint8 {
+			return nil, typeError(fmt.Errorf("unsupported type"))
+		}
+		b := make([]byte, rv.Len())
+		reflect.Copy(reflect.ValueOf(b), rv)
+		switch len(b) {
+		case 4:
+			return &Value{Type: DataTypeUint32, Bytes: b}, nil
+		case 8:
+			return &Value{Type: DataTypeUint64, Bytes: b}, nil
+		}
+		return &Value{Type: DataTypeBlob, Bytes: b}, nil
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return &Value{Type: DataTypeBlob, Bytes: append([]byte{}, rv.Bytes()...)}, nil
+		}
+		val := &Value{Type: DataTypeArray, Elems: make([]*Value, rv.Len())}
+		for i := range val.Elems {
+			elem, err := marshalValue(rv.Index(i))
+			if err != nil {
+				return nil, prependEncodePath(err, strconv.Itoa(i))
+			}
+			val.Elems[i] = elem
+		}
+		return val, nil
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return nil, typeError(fmt.Errorf("unsupported type"))
+		}
+		return marshalMap(rv)
+	case reflect.Struct:
+		return marshalStruct(rv)
+	}
+	return nil, typeError(fmt.Errorf("unsupported type"))
+}
+
+// asMarshaler returns the Marshaler implemented by rv or by its address.
+// Pointers are not considered, they are written as DataTypeOptional wrapping the Marshaler of the pointed value.
+func asMarshaler(rv reflect.Value) (Marshaler, bool) {
+	if rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		return nil, false
+	}
+	if m, ok := rv.Interface().(Marshaler); ok {
+		return m, true
+	}
+	if rv.CanAddr() {
+		m, ok := rv.Addr().Interface().(Marshaler)
+		return m, ok
+	}
+	return nil, false
+}
+
+// marshalInterface returns v as a Value, nil being an absent DataTypeOptional.
+func marshalInterface(v interface{}) (*Value, error) {
+	if v == nil {
+		return &Value{Type: DataTypeOptional}, nil
+	}
+	return marshalValue(reflect.ValueOf(v))
+}
+
+// marshalMap returns a map keyed by field tags as a Value of DataTypeStruct.
+func marshalMap(rv reflect.Value) (*Value, error) {
+	val := &Value{Type: DataTypeStruct, Fields: make([]ValueField, 0, rv.Len())}
+	for _, key := range rv.MapKeys() {
+		tag, err := strconv.ParseInt(key.String(), 10, 64)
+		if err != nil {
+			return nil, &EncodeError{DataType: DataTypeStruct, Err: fmt.Errorf("invalid field tag: %q", key.String())}
+		}
+		fv, err := marshalInterface(rv.MapIndex(key).Interface())
+		if err != nil {
+			return nil, prependEncodePath(err, key.String())
+		}
+		val.Fields = append(val.Fields, ValueField{Tag: tag, Value: fv})
+	}
+	sort.Slice(val.Fields, func(i, j int) bool { return val.Fields[i].Tag < val.Fields[j].Tag })
+	return val, nil
+}
+
+// marshalStruct returns the tagged fields of a struct as a Value of DataTypeStruct.
+func marshalStruct(rv reflect.Value) (*Value, error) {
+	val := &Value{Type: DataTypeStruct}
+	t := rv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tag, optional, ok := parseFieldTag(t.Field(i))
+		if !ok {
+			continue
+		}
+		if optional && rv.Field(i).IsZero() {
+			continue
+		}
+		fv, err := marshalValue(rv.Field(i))
+		if err != nil {
+			return nil, prependEncodePath(err, strconv.FormatInt(tag, 10))
+		}
+		val.Fields = append(val.Fields, ValueField{Tag: tag, Value: fv})
+	}
+	return val, nil
+}
@@ -0,0 +1,75 @@
+package s2mdec
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/icza/s2prot"
+)
+
+func TestMarshal(t *testing.T) {
+	// {0: 5, 1: "abc"}
+	v1 := struct {
+		N int64  `s2m:"0"`
+		S string `s2m:"1"`
+	}{5, "abc"}
+	if data, err := Marshal(&v1); err != nil || !bytes.Equal(data, testStructData) {
+		t.Errorf("Unexpected value: %x %v", data, err)
+	}
+
+	// {0: choice(3, uint8(1)), 1: uint32("abcd")} without the choice
+	v2 := struct {
+		B bool    `s2m:"0"`
+		F [4]byte `s2m:"1"`
+		O *int    `s2m:"2,optional"`
+	}{B: true, F: [4]byte{'a', 'b', 'c', 'd'}}
+	if data, err := Marshal(v2); err != nil || !bytes.Equal(data, []byte{0x05, 0x04, 0x00, 0x06, 0x01, 0x02, 0x07, 'a', 'b', 'c', 'd'}) {
+		t.Errorf("Unexpected value: %x %v", data, err)
+	}
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	type link struct {
+		Namespace int64 `s2m:"0"`
+		ID        int64 `s2m:"1"`
+	}
+	type entry struct {
+		Link    link          `s2m:"0"`
+		Locked  s2prot.BitArr `s2m:"1"`
+		Hidden  *bool         `s2m:"2"`
+		Names   []string      `s2m:"3"`
+		Hash    [8]byte       `s2m:"4"`
+		Blob    []byte        `s2m:"5"`
+		Comment string        `s2m:"6,optional"`
+	}
+	hidden := true
+	in := []entry{
+		{Link: link{999, 3004}, Locked: s2prot.BitArr{Count: 16, Data: []byte{0xff, 0x03}}, Hidden: &hidden, Names: []string{"BLIZ", "FEAT"}, Blob: []byte{0, 1, 2}},
+		{Link: link{-1, 1 << 40}, Locked: s2prot.BitArr{Count: 3, Data: []byte{0x05}}, Names: []string{}, Blob: []byte{}, Comment: "x"},
+	}
+	data, err := Marshal(in)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	var out []entry
+	if err := Unmarshal(data, &out); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("Unexpected value: %+v", out)
+	}
+
+	// The plain representation is written with fields in ascending tag order, values held by interfaces as is
+	for _, data := range [][]byte{
+		testStructData,
+		// [1]
+		{0x00, 0x02, 0x09, 0x02},
+		// {0: [1, {0: "ab"}, []], 1: bitArray(10, 0x0201)}
+		{0x05, 0x04, 0x00, 0x00, 0x06, 0x09, 0x02, 0x05, 0x02, 0x00, 0x02, 0x04, 'a', 'b', 0x00, 0x00, 0x02, 0x01, 0x14, 0x02, 0x01},
+	} {
+		if enc, err := Marshal(NewVersionedDec(data).ReadStruct()); err != nil || !bytes.Equal(enc, data) {
+			t.Errorf("Unexpected value: %x %v", enc, err)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+// Implementation of the order-preserving representation of structs.
+
+package s2mdec
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+
+	"github.com/icza/s2prot"
+)
+
+// OrderedField is a field of an OrderedStruct.
+type OrderedField struct {
+	Tag   int64       // Field tag as read from the wire
+	Value interface{} // Decoded value of the field
+}
+
+// OrderedStruct is a decoded DataTypeStruct whose fields are kept in wire order.
+// VersionedDec produces it instead of s2prot.Struct if VersionedDec.OrderedStructs is set.
+type OrderedStruct []OrderedField
+
+// Field returns the value of the field with the given tag, and tells if the field exists.
+func (s OrderedStruct) Field(tag int64) (interface{}, bool) {
+	for _, f := range s {
+		if f.Tag == tag {
+			return f.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Value returns the value specified by the tags path.
+// nil is returned if any of the fields along the path is missing or is not an OrderedStruct.
+func (s OrderedStruct) Value(tags ...int64) interface{} {
+	var v interface{} = s
+	for _, tag := range tags {
+		s, ok := v.(OrderedStruct)
+		if !ok {
+			return nil
+		}
+		if v, ok = s.Field(tag); !ok {
+			return nil
+		}
+	}
+	return v
+}
+
+// Tags returns the field tags in wire order.
+func (s OrderedStruct) Tags() []int64 {
+	tags := make([]int64, len(s))
+	for i, f := range s {
+		tags[i] = f.Tag
+	}
+	return tags
+}
+
+// Struct converts s and all OrderedStructs nested in it to s2prot.Struct,
+// which is the representation expected by the labelers such as ReadS2MH.
+func (s OrderedStruct) Struct() s2prot.Struct {
+	ret := make(s2prot.Struct, len(s))
+	for _, f := range s {
+		ret[strconv.FormatInt(f.Tag, 10)] = unorderValue(f.Value)
+	}
+	return ret
+}
+
+// unorderValue converts OrderedStructs nested in v to s2prot.Struct.
+func unorderValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case OrderedStruct:
+		return v.Struct()
+	case []interface{}:
+		ret := make([]interface{}, len(v))
+		for i, elem := range v {
+			ret[i] = unorderValue(elem)
+		}
+		return ret
+	}
+	return v
+}
+
+// MarshalJSON implements json.Marshaler. Fields are written in wire order keyed by their tags.
+// HTML characters of strings are not escaped, the encoder of the output escapes them if it is set to.
+func (s OrderedStruct) MarshalJSON() ([]byte, error) {
+	buf := bytes.Buffer{}
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	buf.WriteByte('{')
+	for i, f := range s {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteByte('"')
+		buf.WriteString(strconv.FormatInt(f.Tag, 10))
+		buf.WriteString(`":`)
+		if err := enc.Encode(f.Value); err != nil {
+			return nil, err
+		}
+		buf.Truncate(buf.Len() - 1) // newline written by Encode
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// String returns the indented JSON string representation of the OrderedStruct.
+// Defined with value receiver so this gets called even if a non-pointer is printed.
+func (s OrderedStruct) String() string {
+	b, _ := json.MarshalIndent(s, "", "  ")
+	return string(b)
+}
@@ -0,0 +1,95 @@
+// Strongly typed model of the labeled s2gs.
+
+package s2mdec
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/icza/s2prot"
+)
+
+// GameSummary is the typed form of the labeled s2gs returned by ReadS2GS.
+// JSON field names are the same as the keys of the labeled s2gs,
+// StartTime is converted from seconds since the Unix epoch to time.Time (zero if not set).
+type GameSummary struct {
+	GameSpeed    string                `json:"gameSpeed"`
+	Map          InstanceHeader        `json:"map"`     // instance header of the map played
+	Players      []PlayerSummary       `json:"players"` // a player for each slot in lobby
+	Attributes   []AttributeDefinition `json:"attributes"`
+	WorkingSet   WorkingSet            `json:"workingSet"`
+	GameDuration int64                 `json:"gameDuration"` // game seconds
+	StartTime    time.Time             `json:"startTime"`
+	Stats        []Stat                `json:"stats"`
+
+	// Instances not understood yet, kept raw.
+	UnkParts []interface{} `json:"_unkParts"`
+	// Fields not understood yet keyed by path, kept raw.
+	Unknown s2prot.Struct `json:"_unknown"`
+}
+
+// PlayerSummary is the player of a slot in lobby.
+// The s2gs does not hold the names of the players, they are told by their toon handles.
+type PlayerSummary struct {
+	PlayerID    int64             `json:"playerId"`
+	ToonHandle  *ToonHandle       `json:"toonHandle"` // nil for computers and closed slots
+	Result      *PlayerResult     `json:"result"`
+	LobbyValues map[string]string `json:"lobbyValues"` // values of the attributes in lobby keyed by attribute id
+	Race        string            `json:"race"`        // e.g. "Terr" or "RAND"
+	Team        string            `json:"team"`        // e.g. "T1", empty if the game mode has no teams
+
+	// Fields not understood yet keyed by path, kept raw.
+	Unknown s2prot.Struct `json:"_unknown"`
+}
+
+// PlayerResult is the result of a player.
+type PlayerResult struct {
+	Decision int64 `json:"decision"` // see the Decision consts
+}
+
+// Decision consts, the values of PlayerResult.Decision.
+const (
+	DecisionWin       int64 = iota // Won the game
+	DecisionLoss                   // Lost the game
+	DecisionTie                    // Tied the game
+	DecisionUndecided              // Not decided, e.g. left before the end of the game
+)
+
+// IsWinner tells if the player won the game.
+func (p PlayerSummary) IsWinner() bool {
+	return p.Result != nil && p.Result.Decision == DecisionWin
+}
+
+// Stat is a score, a graph or a build order of the players.
+type Stat struct {
+	Stat   AttributeLink `json:"stat"`   // ids of scores are below 1000000, those of build orders from 2000000
+	Values [][]StatPoint `json:"values"` // points of each player, a single one for scores
+}
+
+// StatPoint is a value of a stat at a time.
+type StatPoint struct {
+	Value int64 `json:"value"`
+	Time  int64 `json:"time"`
+}
+
+// NewGameSummary converts the labeled s2gs returned by ReadS2GS to GameSummary.
+func NewGameSummary(labeled s2prot.Struct) (*GameSummary, error) {
+	gs := &GameSummary{}
+	if err := fromLabeled(labeled, gs); err != nil {
+		return nil, fmt.Errorf("s2gs: %w", err)
+	}
+	return gs, nil
+}
+
+// DecodeS2GS reads the container of an s2gs file, then decodes and labels its instances.
+func DecodeS2GS(data []byte) (*GameSummary, error) {
+	f, err := ReadS2GSFile(data)
+	if err != nil {
+		return nil, err
+	}
+	labeled, err := ReadS2GS(f.Instances())
+	if err != nil {
+		return nil, fmt.Errorf("s2gs: %w", err)
+	}
+	return NewGameSummary(labeled)
+}
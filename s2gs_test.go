@@ -0,0 +1,137 @@
+package s2mdec
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/icza/s2prot"
+)
+
+// testAttributeDef returns the definition of the attribute in lobby id whose values are values.
+func testAttributeDef(id int64, values ...string) s2prot.Struct {
+	valueDefs := []interface{}{}
+	for _, v := range values {
+		valueDefs = append(valueDefs, s2prot.Struct{"0": v, "1": s2prot.Struct{"0": testLocKey(3), "1": testLocKey(0), "2": testPicture(4)}, "2": []interface{}{}})
+	}
+	return s2prot.Struct{
+		"0": testAttributeLink(id),
+		"1": valueDefs,
+		"2": s2prot.Struct{"0": testLocKey(5), "1": testLocKey(0), "2": testPicture(6)},
+		"3": []interface{}{},
+		"4": int64(1),
+		"5": int64(3),
+		"6": int64(2),
+		"7": int64(0x02),
+		"8": s2prot.Struct{"0": int64(0), "1": int64(0)},
+		"9": int64(7),
+	}
+}
+
+// testS2GS returns the instances of a synthetic unlabeled s2gs of a 1v1 against the computer.
+func testS2GS() []s2prot.Struct {
+	unlabeled := testS2MH()
+	s2mh := unlabeled.Structv("0")
+	attributes := []interface{}{testAttributeDef(3001, "Terr", "Zerg"), testAttributeDef(2000, "1v1", "2v2"), testAttributeDef(2001, "T1", "T2")}
+	index := func(i int64) s2prot.Struct {
+		return s2prot.Struct{"0": i, "1": int64(0)}
+	}
+	workingSet := s2mh.Structv("4")
+	workingSet["6"] = []interface{}{
+		s2prot.Struct{"0": testAttributeLink(3001), "1": []interface{}{index(1), index(0)}},
+		s2prot.Struct{"0": testAttributeLink(2000), "1": index(0)},
+		s2prot.Struct{"0": testAttributeLink(2001), "1": []interface{}{index(0), index(1)}},
+	}
+	toonHandle := s2prot.Struct{"0": int64(2), "1": "S2\x00\x00", "2": int64(1), "3": int64(1234567)}
+	stat := func(id int64, values ...int64) s2prot.Struct {
+		points := []interface{}{}
+		for _, v := range values {
+			points = append(points, []interface{}{s2prot.Struct{"0": v, "1": int64(0), "2": int64(0)}})
+		}
+		return s2prot.Struct{"0": testAttributeLink(id), "1": points}
+	}
+	return []s2prot.Struct{
+		{
+			"0": s2prot.Struct{"0": int64(0), "1": "Fasr"},
+			"2": s2prot.Struct{"0": int64(11987), "1": int64(283385849), "2": int64(1334719793)},
+			"3": []interface{}{
+				s2prot.Struct{"0": s2prot.Struct{"0": int64(1), "1": s2prot.Struct{"0": toonHandle, "1": int64(0)}}, "1": s2prot.Struct{"0": int64(0)}},
+				s2prot.Struct{"0": s2prot.Struct{"0": int64(2), "1": int64(3)}, "1": s2prot.Struct{"0": int64(1)}},
+			},
+			"5": attributes,
+			"6": workingSet,
+			"7": int64(754),
+			"8": int64(1334719793),
+		},
+		{"0": []interface{}{}},
+		{"0": []interface{}{}},
+		{"0": []interface{}{stat(1, 1200, 950)}},
+		{"0": []interface{}{stat(2, 30, 25), stat(2000001)}},
+	}
+}
+
+func TestReadS2GS(t *testing.T) {
+	labeled, err := ReadS2GS(testS2GS())
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	gs, err := NewGameSummary(labeled)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if gs.GameSpeed != "Fasr" || gs.Map.ID != 11987 || gs.Map.Version != 283385849 || gs.GameDuration != 754 || !gs.StartTime.Equal(time.Date(2012, 4, 18, 3, 29, 53, 0, time.UTC)) {
+		t.Error("Unexpected value!")
+	}
+	if len(gs.Players) != 2 || len(gs.Stats) != 3 || len(gs.UnkParts) != 2 || len(gs.WorkingSet.LocaleTable) != 2 {
+		t.Fatal("Unexpected value!")
+	}
+	human, computer := gs.Players[0], gs.Players[1]
+	if human.ToonHandle == nil || human.ToonHandle.String() != "2-S2-1-1234567" || !human.IsWinner() || human.Race != "Zerg" || human.Team != "T1" {
+		t.Error("Unexpected value:", human)
+	}
+	if computer.ToonHandle != nil || computer.IsWinner() || computer.Result.Decision != DecisionLoss || computer.Race != "Terr" || computer.Team != "T2" || computer.LobbyValues["3001"] != "Terr" {
+		t.Error("Unexpected value:", computer)
+	}
+	if s := gs.Stats[1]; s.Stat.ID != 2 || len(s.Values) != 2 || s.Values[1][0].Value != 25 {
+		t.Error("Unexpected value:", s)
+	}
+	if !reflect.DeepEqual(gs.Unknown, s2prot.Struct{"0.0": int64(0)}) || !reflect.DeepEqual(labeled.Value("map", "_unknown"), s2prot.Struct{"2": int64(1334719793)}) {
+		t.Error("Unexpected value:", gs.Unknown)
+	}
+	if !reflect.DeepEqual(human.Unknown, s2prot.Struct{"0.1.1": int64(0)}) || !reflect.DeepEqual(computer.Unknown, s2prot.Struct{"0.1": int64(3)}) {
+		t.Error("Unexpected value!")
+	}
+
+	// The race attribute is told by its values if it is not attributeRace
+	parts := testS2GS()
+	parts[0]["5"].([]interface{})[0].(s2prot.Struct)["0"] = testAttributeLink(4001)
+	parts[0]["6"].(s2prot.Struct)["6"].([]interface{})[0].(s2prot.Struct)["0"] = testAttributeLink(4001)
+	if labeled, err = ReadS2GS(parts); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if player := labeled["players"].([]interface{})[0].(s2prot.Struct); player["race"] != "Zerg" {
+		t.Error("Unexpected value:", player)
+	}
+
+	// Teams are those of the attribute of the game mode
+	parts = testS2GS()
+	parts[0]["6"].(s2prot.Struct)["6"].([]interface{})[1].(s2prot.Struct)["1"] = s2prot.Struct{"0": int64(1), "1": int64(0)}
+	if labeled, err = ReadS2GS(parts); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if player := labeled["players"].([]interface{})[0].(s2prot.Struct); player["team"] != "" || player.Stringv("lobbyValues", "2000") != "2v2" {
+		t.Error("Unexpected value:", player)
+	}
+
+	parts = testS2GS()
+	parts[4]["0"] = int64(0)
+	_, err = ReadS2GS(parts)
+	var errLabel *LabelError
+	if !errors.As(err, &errLabel) || errLabel.Path != "/stats" {
+		t.Error("Unexpected error:", err)
+	}
+	if _, err := ReadS2GS(nil); err == nil {
+		t.Error("Expected error for no instances!")
+	}
+}
@@ -0,0 +1,125 @@
+// Implementation of the container of s2gs files.
+
+package s2mdec
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/icza/s2prot"
+)
+
+// S2GSMagic is the magic starting the header of each section of an s2gs file.
+const S2GSMagic = "ZLib"
+
+// S2GSHeaderSize is the size of the header of each section of an s2gs file in bytes.
+const S2GSHeaderSize = 16
+
+// S2GSHeader is the header of a section of an s2gs file: the magic followed by 3 little endian uint32.
+type S2GSHeader struct {
+	Magic            string // S2GSMagic
+	Unk              uint32 // not understood yet
+	DecompressedSize uint32 // Size of the decompressed data in bytes
+	CompressedSize   uint32 // Size of the zlib stream following the header in bytes
+}
+
+// S2GSSection is a section of an s2gs file, a zlib stream of versioned instances.
+type S2GSSection struct {
+	Header    S2GSHeader
+	Offset    int64           // Offset of the header in the file
+	Data      []byte          // Decompressed data
+	Instances []s2prot.Struct // Instances decoded from Data, usually a single one
+}
+
+// S2GSFile is the container of a game summary: sections following each other up to the end of the file.
+type S2GSFile struct {
+	Sections []S2GSSection
+}
+
+// Instances returns the instances of all sections in order, as expected by ReadS2GS.
+func (f *S2GSFile) Instances() []s2prot.Struct {
+	var instances []s2prot.Struct
+	for _, s := range f.Sections {
+		instances = append(instances, s.Instances...)
+	}
+	return instances
+}
+
+// ReadS2GSFile reads the container of an s2gs file, decompressing and decoding each section.
+// The magic and the declared sizes of each section are verified, the decompressed size being limited
+// by DefaultLimits.MaxAlloc. Each decompressed section must hold structs only, decoded with DefaultLimits.
+func ReadS2GSFile(data []byte) (*S2GSFile, error) {
+	f := &S2GSFile{}
+	for offset := 0; offset < len(data); {
+		section, err := readS2GSSection(data[offset:])
+		if err != nil {
+			return nil, fmt.Errorf("s2gs: section %d at %d: %w", len(f.Sections), offset, err)
+		}
+		section.Offset = int64(offset)
+		f.Sections = append(f.Sections, *section)
+		offset += S2GSHeaderSize + int(section.Header.CompressedSize)
+	}
+	if len(f.Sections) == 0 {
+		return nil, fmt.Errorf("s2gs: %w", io.ErrUnexpectedEOF)
+	}
+	return f, nil
+}
+
+// readS2GSSection reads the section at the beginning of data.
+func readS2GSSection(data []byte) (*S2GSSection, error) {
+	// header
+	if len(data) < S2GSHeaderSize {
+		return nil, fmt.Errorf("header: %w", io.ErrUnexpectedEOF)
+	}
+	h := S2GSHeader{
+		Magic:            string(data[:4]),
+		Unk:              binary.LittleEndian.Uint32(data[4:]),
+		DecompressedSize: binary.LittleEndian.Uint32(data[8:]),
+		CompressedSize:   binary.LittleEndian.Uint32(data[12:]),
+	}
+	if h.Magic != S2GSMagic {
+		return nil, fmt.Errorf("unexpected magic: %q", h.Magic)
+	}
+	if int64(h.CompressedSize) > int64(len(data)-S2GSHeaderSize) {
+		return nil, fmt.Errorf("compressed size %d exceeds the remaining %d bytes", h.CompressedSize, len(data)-S2GSHeaderSize)
+	}
+	if limit := DefaultLimits.MaxAlloc; limit > 0 && int64(h.DecompressedSize) > limit {
+		return nil, fmt.Errorf("%w: decompressed size %d exceeds %d", ErrLimitExceeded, h.DecompressedSize, limit)
+	}
+	// zlib
+	rCompressed := bytes.NewReader(data[S2GSHeaderSize : S2GSHeaderSize+int(h.CompressedSize)])
+	rZlib, err := zlib.NewReader(rCompressed)
+	if err != nil {
+		return nil, err
+	}
+	defer rZlib.Close()
+	decompressed, err := ioutil.ReadAll(io.LimitReader(rZlib, int64(h.DecompressedSize)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(decompressed) != int(h.DecompressedSize) {
+		return nil, fmt.Errorf("unexpected decompressed size: %d, declared %d", len(decompressed), h.DecompressedSize)
+	}
+	if rCompressed.Len() > 0 {
+		return nil, fmt.Errorf("unexpected compressed size: %d, declared %d", int(h.CompressedSize)-rCompressed.Len(), h.CompressedSize)
+	}
+	// instances
+	section := &S2GSSection{Header: h, Data: decompressed}
+	dec := NewVersionedDec(decompressed)
+	for !dec.EOF() {
+		v, err := dec.Decode()
+		if err != nil {
+			return nil, fmt.Errorf("instance %d: %w", len(section.Instances), err)
+		}
+		instance, ok := v.(s2prot.Struct)
+		if !ok {
+			return nil, fmt.Errorf("instance %d: %w", len(section.Instances), errStructInvalid)
+		}
+		section.Instances = append(section.Instances, instance)
+	}
+	return section, nil
+}
@@ -0,0 +1,83 @@
+package s2mdec
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/icza/s2prot"
+)
+
+// testS2GSSection returns a section of an s2gs file holding instances, junk being appended to the zlib stream.
+func testS2GSSection(t *testing.T, junk []byte, instances ...s2prot.Struct) []byte {
+	var data, compressed bytes.Buffer
+	for _, instance := range instances {
+		b, err := Marshal(instance)
+		if err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+		data.Write(b)
+	}
+	w := zlib.NewWriter(&compressed)
+	w.Write(data.Bytes())
+	w.Close()
+	compressed.Write(junk)
+	header := make([]byte, S2GSHeaderSize)
+	copy(header, S2GSMagic)
+	binary.LittleEndian.PutUint32(header[4:], 1)
+	binary.LittleEndian.PutUint32(header[8:], uint32(data.Len()))
+	binary.LittleEndian.PutUint32(header[12:], uint32(compressed.Len()))
+	return append(header, compressed.Bytes()...)
+}
+
+func TestReadS2GSFile(t *testing.T) {
+	parts := testS2GS()
+	data := append(testS2GSSection(t, nil, parts[:3]...), testS2GSSection(t, nil, parts[3:]...)...)
+	f, err := ReadS2GSFile(data)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if len(f.Sections) != 2 || len(f.Sections[0].Instances) != 3 || len(f.Instances()) != len(parts) {
+		t.Fatal("Unexpected value!")
+	}
+	if s := f.Sections[1]; s.Header.Unk != 1 || s.Offset != int64(S2GSHeaderSize+f.Sections[0].Header.CompressedSize) {
+		t.Error("Unexpected value:", s.Header)
+	}
+	gs, err := DecodeS2GS(data)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if len(gs.Players) != 2 || len(gs.Stats) != 3 {
+		t.Error("Unexpected value!")
+	}
+
+	cases := []struct {
+		name   string
+		data   []byte
+		errMsg string
+	}{
+		{"empty", nil, "unexpected EOF"},
+		{"truncated header", data[:8], "section 0 at 0: header: unexpected EOF"},
+		{"magic", append([]byte("ZLIB"), data[4:]...), "unexpected magic"},
+		{"truncated stream", data[:len(data)-1], "section 1"},
+		{"junk", testS2GSSection(t, []byte{0}, parts[0]), "unexpected compressed size"},
+	}
+	for _, c := range cases {
+		if _, err := ReadS2GSFile(c.data); err == nil || !strings.Contains(err.Error(), c.errMsg) {
+			t.Errorf("Unexpected error for %s: %v", c.name, err)
+		}
+	}
+
+	size := append([]byte{}, data...)
+	binary.LittleEndian.PutUint32(size[8:], 1)
+	if _, err := ReadS2GSFile(size); err == nil || !strings.Contains(err.Error(), "unexpected decompressed size") {
+		t.Error("Unexpected error:", err)
+	}
+	binary.LittleEndian.PutUint32(size[8:], 1<<31)
+	if _, err := ReadS2GSFile(size); !errors.Is(err, ErrLimitExceeded) {
+		t.Error("Unexpected error:", err)
+	}
+}
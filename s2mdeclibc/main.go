@@ -7,6 +7,7 @@ package main
 import "C"
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -29,9 +30,9 @@ func s2mdec_read_s2mi(buf *C.char, size C.int) (ret *C.char) {
 		}
 	}()
 	//
-	unlabeled, ok := s2mdec.NewVersionedDec(C.GoBytes(unsafe.Pointer(buf), size)).ReadStruct().(s2prot.Struct)
-	if !ok {
-		return C.CString("invalid s2mi")
+	unlabeled, err := readStruct(C.GoBytes(unsafe.Pointer(buf), size))
+	if err != nil {
+		return C.CString(fmt.Sprint("s2mi: ", err))
 	}
 	labeled, err := s2mdec.ReadS2MI(unlabeled)
 	if err != nil {
@@ -57,9 +58,9 @@ func s2mdec_read_s2mh(buf *C.char, size C.int) (ret *C.char) {
 		}
 	}()
 	//
-	unlabeled, ok := s2mdec.NewVersionedDec(C.GoBytes(unsafe.Pointer(buf), size)).ReadStruct().(s2prot.Struct)
-	if !ok {
-		return C.CString("invalid s2mh")
+	unlabeled, err := readStruct(C.GoBytes(unsafe.Pointer(buf), size))
+	if err != nil {
+		return C.CString(fmt.Sprint("s2mh: ", err))
 	}
 	labeled, err := s2mdec.ReadS2MH(unlabeled)
 	if err != nil {
@@ -111,11 +112,10 @@ func s2mdec_read_s2mh_s2ml(bufS2MH *C.char, sizeS2MH C.int, bufS2ML *C.char, siz
 	//
 	s2mh, s2ml := s2prot.Struct(nil), s2mdec.MapLocale(nil)
 	{ // s2mh
-		unlabeled, ok := s2mdec.NewVersionedDec(C.GoBytes(unsafe.Pointer(bufS2MH), sizeS2MH)).ReadStruct().(s2prot.Struct)
-		if !ok {
-			return C.CString("invalid s2mh")
+		unlabeled, err := readStruct(C.GoBytes(unsafe.Pointer(bufS2MH), sizeS2MH))
+		if err != nil {
+			return C.CString(fmt.Sprint("s2mh: ", err))
 		}
-		var err error
 		s2mh, err = s2mdec.ReadS2MH(unlabeled)
 		if err != nil {
 			return C.CString(fmt.Sprint("s2mh: ", err))
@@ -146,6 +146,19 @@ func main() {
 	// Entry point: Do nothing.
 }
 
+// readStruct decodes data whose top-level instance is expected to be a struct.
+func readStruct(data []byte) (s2prot.Struct, error) {
+	v, err := s2mdec.NewVersionedDec(data).Decode()
+	if err != nil {
+		return nil, err
+	}
+	unlabeled, ok := v.(s2prot.Struct)
+	if !ok {
+		return nil, errors.New("invalid struct")
+	}
+	return unlabeled, nil
+}
+
 func writeJSON(w io.Writer, v interface{}) error {
 	enc := json.NewEncoder(w)
 	enc.SetEscapeHTML(false)
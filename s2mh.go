@@ -0,0 +1,328 @@
+// Strongly typed model of the labeled s2mh.
+
+package s2mdec
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/icza/s2prot"
+)
+
+// MapHeader is the typed form of the labeled s2mh returned by ReadS2MH.
+// JSON field names are the same as the keys of the labeled s2mh.
+// Fields introduced by later s2mh versions are left zero when decoding earlier versions.
+type MapHeader struct {
+	Header                InstanceHeader        `json:"header"`
+	Filename              string                `json:"filename"`
+	ArchiveHandle         DepotLink             `json:"archiveHandle"`
+	MapNamespace          int64                 `json:"mapNamespace"`
+	WorkingSet            WorkingSet            `json:"workingSet"`
+	Attributes            []AttributeDefinition `json:"attributes"`
+	ResultDefinitions     []ResultDefinition    `json:"resultDefinitions"`
+	LocaleTable           []LocalizationLink    `json:"localeTable"`
+	MapSize               *MapSize              `json:"mapSize"`
+	Tileset               *LocalizationKey      `json:"tileset"`
+	DefaultVariantIndex   int64                 `json:"defaultVariantIndex"`
+	Variants              []Variant             `json:"variants"`
+	SpecialTags           []string              `json:"specialTags"`
+	ExtraDependencies     []InstanceHeader      `json:"extraDependencies"`     // ver >= 14
+	AddDefaultPermissions bool                  `json:"addDefaultPermissions"` // ver >= 18
+	RelevantPermissions   []Permission          `json:"relevantPermissions"`   // ver >= 18
+	ArcadeInfo            *ArcadeInfo           `json:"arcadeInfo"`            // ver >= 22
+	AddMultiMod           bool                  `json:"addMultiMod"`           // ver >= 22
+	VoicePacks            []string              `json:"voicePacks"`            // ver >= 23
+	RewardIDs             []int64               `json:"rewardIds"`             // ver >= 24, possibly reward IDs
+
+	// Fields not understood yet keyed by path, kept raw: tag 6, 17 (ver >= 18), 20 and 21 (ver >= 22).
+	Unknown s2prot.Struct `json:"_unknown"`
+}
+
+// InstanceHeader identifies a published version of a map or mod.
+type InstanceHeader struct {
+	ID      int64 `json:"id"`
+	Version int64 `json:"version"` // major version << 16 | minor version
+}
+
+// MajorVersion returns the major part of Version.
+func (h InstanceHeader) MajorVersion() int64 {
+	return h.Version >> 16
+}
+
+// MinorVersion returns the minor part of Version.
+func (h InstanceHeader) MinorVersion() int64 {
+	return h.Version & 0xFFFF
+}
+
+// DepotLink refers to a file in the Battle.net depot.
+type DepotLink struct {
+	Type   string `json:"type"`   // File type such as "s2ma", "s2ml" or "s2mv"
+	Region string `json:"region"` // Lower case region such as "us" or "eu"
+	Hash   string `json:"hash"`   // Hex encoded hash of the file
+}
+
+// Filename returns the name of the file in the Battle.net cache and depot.
+func (l DepotLink) Filename() string {
+	return l.Hash + "." + l.Type
+}
+
+// LocalizationLink lists the string tables of a locale.
+type LocalizationLink struct {
+	Locale      string      `json:"locale"`
+	StringTable []DepotLink `json:"stringTable"`
+}
+
+// LocalizationKey refers to a string of the string tables.
+type LocalizationKey struct {
+	Color *int64 `json:"color"`
+	Table int64  `json:"table"`
+	Index int64  `json:"index"` // 0 for no string
+}
+
+// Picture is a rectangle of an image.
+type Picture struct {
+	Index  int64 `json:"index"`
+	Top    int64 `json:"top"`
+	Left   int64 `json:"left"`
+	Height int64 `json:"height"`
+	Width  int64 `json:"width"`
+}
+
+// MapSize is the playable size of a map.
+type MapSize struct {
+	Horizontal int64 `json:"horizontal"`
+	Vertical   int64 `json:"vertical"`
+}
+
+// WorkingSet holds the general information of a map.
+type WorkingSet struct {
+	Name        *LocalizationKey     `json:"name"`
+	Description *LocalizationKey     `json:"description"`
+	Thumbnail   *Picture             `json:"thumbnail"`
+	BigMap      *Picture             `json:"bigMap"`
+	MaxPlayers  int64                `json:"maxPlayers"`
+	Instances   []AttributeDefault   `json:"instances"`
+	VisualFiles []DepotLink          `json:"visualFiles"`
+	LocaleTable []LocalizationLink   `json:"localeTable"`
+	Licenses    []LicenseRequirement `json:"licenses"` // ver >= 11
+}
+
+// LicenseRequirement lists the licenses required by a value of an attribute.
+type LicenseRequirement struct {
+	Attribute AttributeLink `json:"attribute"`
+	Value     int64         `json:"value"`
+	Licenses  []License     `json:"licenses"`
+}
+
+// License is a license required to play a map.
+type License struct {
+	Name string `json:"name"`
+	ID   int64  `json:"id"`
+}
+
+// AttributeLink identifies an attribute.
+type AttributeLink struct {
+	Namespace int64 `json:"namespace"`
+	ID        int64 `json:"id"`
+}
+
+// AttributeVisual is the presentation of an attribute or an attribute value.
+type AttributeVisual struct {
+	Text *LocalizationKey `json:"text"`
+	Tip  *LocalizationKey `json:"tip"`
+	Art  *Picture         `json:"art"`
+}
+
+// AttributeValueDefinition is a possible value of an attribute.
+type AttributeValueDefinition struct {
+	Value  string          `json:"value"`
+	Visual AttributeVisual `json:"visual"`
+}
+
+// AttributeValueIndex refers to an AttributeValueDefinition by its index.
+type AttributeValueIndex struct {
+	Index int64 `json:"index"`
+}
+
+// AttributeValueIndices is either a single value, or one value per lobby slot if PerSlot is set.
+// In JSON it is an object in the former and an array in the latter case.
+type AttributeValueIndices struct {
+	PerSlot bool
+	Values  []AttributeValueIndex
+}
+
+// MarshalJSON implements json.Marshaler.
+func (v AttributeValueIndices) MarshalJSON() ([]byte, error) {
+	if !v.PerSlot && len(v.Values) == 1 {
+		return json.Marshal(v.Values[0])
+	}
+	if v.Values == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(v.Values)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (v *AttributeValueIndices) UnmarshalJSON(b []byte) error {
+	var single AttributeValueIndex
+	if err := json.Unmarshal(b, &single); err == nil {
+		v.PerSlot, v.Values = false, []AttributeValueIndex{single}
+		return nil
+	}
+	v.PerSlot, v.Values = true, nil
+	return json.Unmarshal(b, &v.Values)
+}
+
+// unmarshalLabeled implements labeledUnmarshaler, a single value being a struct and one value per slot an array.
+func (v *AttributeValueIndices) unmarshalLabeled(labeled interface{}) error {
+	if _, ok := labeled.(s2prot.Struct); ok {
+		v.PerSlot, v.Values = false, make([]AttributeValueIndex, 1)
+		return fromLabeled(labeled, &v.Values[0])
+	}
+	v.PerSlot, v.Values = true, nil
+	return fromLabeled(labeled, &v.Values)
+}
+
+// AttributeDefinition describes an attribute of the lobby.
+type AttributeDefinition struct {
+	Instance    AttributeLink              `json:"instance"`
+	Values      []AttributeValueDefinition `json:"values"`
+	Visual      AttributeVisual            `json:"visual"`
+	Arbitration int64                      `json:"arbitration"` // 0: always, 1: first come first serve
+	Visibility  int64                      `json:"visibility"`  // 0: none, 1: self, 2: host, 3: all
+	Access      int64                      `json:"access"`      // 0: none, 1: self, 2: host, 3: all
+	Options     int64                      `json:"options"`     // 0x02: locked when public, 0x04: hidden
+	Default     AttributeValueIndices      `json:"default"`
+	SortOrder   int64                      `json:"sortOrder"`
+
+	Requirements interface{} `json:"_requirements"` // not understood yet, kept raw as returned by ReadStruct
+}
+
+// AttributeDefault is the default value of an attribute.
+type AttributeDefault struct {
+	Attribute AttributeLink         `json:"attribute"`
+	Value     AttributeValueIndices `json:"value"`
+}
+
+// LockedAttribute tells the lobby slots in which an attribute is locked.
+type LockedAttribute struct {
+	Attribute    AttributeLink `json:"attribute"`
+	LockedScopes int64         `json:"lockedScopes"` // 16-bit integer whose bit is for each slot in lobby
+}
+
+// AttributeVisibility tells if an attribute is hidden.
+type AttributeVisibility struct {
+	Attribute AttributeLink `json:"attribute"`
+	Hidden    int64         `json:"hidden"`
+}
+
+// PremiumInfo describes the license required by a variant.
+type PremiumInfo struct {
+	License int64 `json:"license"`
+}
+
+// Variant is a game mode of a map.
+type Variant struct {
+	CategoryID            int64                  `json:"categoryId"`
+	ModeID                int64                  `json:"modeId"`
+	CategoryName          *LocalizationKey       `json:"categoryName"`
+	ModeName              *LocalizationKey       `json:"modeName"`
+	CategoryDescription   *LocalizationKey       `json:"categoryDescription"`
+	ModeDescription       *LocalizationKey       `json:"modeDescription"`
+	AttributeDefaults     []AttributeDefault     `json:"attributeDefaults"`
+	LockedAttributes      []LockedAttribute      `json:"lockedAttributes"`
+	MaxTeamSize           int64                  `json:"maxTeamSize"`
+	AttributeVisibility   []AttributeVisibility  `json:"attributeVisibility"`   // ver >= 11
+	AttributeRestrictions []AttributeRestriction `json:"attributeRestrictions"` // ver >= 11
+	AchievementTags       []string               `json:"achievementTags"`       // ver >= 11
+	MaxHumanPlayers       *int64                 `json:"maxHumanPlayers"`       // ver >= 12
+	MaxOpenSlots          *int64                 `json:"maxOpenSlots"`          // ver >= 13
+	PremiumInfo           *PremiumInfo           `json:"premiumInfo"`           // ver >= 14
+	TeamNames             []*LocalizationKey     `json:"teamNames"`             // ver >= 15
+}
+
+// AttributeRestriction restricts the values of an attribute to some lobby slots.
+// AllowedSlots holds for each value of the attribute the indices of the slots it is allowed in.
+type AttributeRestriction struct {
+	Attribute    AttributeLink `json:"attribute"`
+	AllowedSlots [][]int64     `json:"allowedSlots"`
+}
+
+// ResultDefinition is a result, e.g. a score, reported by a map.
+type ResultDefinition struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"` // e.g. "Score"
+
+	// Fields not understood yet keyed by path, kept raw.
+	Unknown s2prot.Struct `json:"_unknown"`
+}
+
+// Permission is a permission relevant to a map.
+type Permission struct {
+	Name string `json:"name"`
+	ID   int64  `json:"id"`
+}
+
+// ArcadeInfo is the information presented by the arcade.
+type ArcadeInfo struct {
+	GameInfoScreenshots  []ScreenshotEntry `json:"gameInfoScreenshots"`
+	HowToPlayScreenshots []ScreenshotEntry `json:"howToPlayScreenshots"`
+	HowToPlaySections    []ArcadeSection   `json:"howToPlaySections"`
+	PatchNoteSections    []ArcadeSection   `json:"patchNoteSections"`
+	MapIcon              *Picture          `json:"mapIcon"`
+	TutorialLink         *TutorialLink     `json:"tutorialLink"`
+	MatchmakerTags       []string          `json:"matchmakerTags"`
+	Website              *LocalizationKey  `json:"website"`
+}
+
+// ScreenshotEntry is a screenshot with its caption.
+type ScreenshotEntry struct {
+	Picture *Picture         `json:"picture"`
+	Caption *LocalizationKey `json:"caption"`
+}
+
+// ArcadeSection is a section of text items.
+type ArcadeSection struct {
+	Title    *LocalizationKey   `json:"title"`
+	ListType int64              `json:"listType"` // 0: bulleted, 1: numbered, 2: none
+	Subtitle *LocalizationKey   `json:"subtitle"`
+	Items    []*LocalizationKey `json:"items"`
+}
+
+// TutorialLink refers to the tutorial of a map.
+type TutorialLink struct {
+	VariantIndex int64          `json:"variantIndex"`
+	Speed        string         `json:"speed"`
+	Map          InstanceHeader `json:"map"`
+}
+
+// NewMapHeader converts the labeled s2mh returned by ReadS2MH to MapHeader.
+func NewMapHeader(labeled s2prot.Struct) (*MapHeader, error) {
+	hdr := &MapHeader{}
+	if err := fromLabeled(labeled, hdr); err != nil {
+		return nil, fmt.Errorf("s2mh: %w", err)
+	}
+	return hdr, nil
+}
+
+// DecodeS2MH decodes and labels the contents of an s2mh file.
+func DecodeS2MH(data []byte) (*MapHeader, error) {
+	labeled, err := decodeLabeled(data, ReadS2MH)
+	if err != nil {
+		return nil, err
+	}
+	return NewMapHeader(labeled)
+}
+
+// decodeLabeled decodes data whose top-level instance is a struct and labels it with fnLabel.
+func decodeLabeled(data []byte, fnLabel func(s2prot.Struct) (s2prot.Struct, error)) (s2prot.Struct, error) {
+	v, err := NewVersionedDec(data).Decode()
+	if err != nil {
+		return nil, err
+	}
+	unlabeled, ok := v.(s2prot.Struct)
+	if !ok {
+		return nil, errStructInvalid
+	}
+	return fnLabel(unlabeled)
+}
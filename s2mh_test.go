@@ -0,0 +1,245 @@
+package s2mdec
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/icza/s2prot"
+)
+
+func testLocKey(index int64) s2prot.Struct {
+	return s2prot.Struct{"0": nil, "1": int64(0), "2": index}
+}
+
+func testPicture(index int64) s2prot.Struct {
+	return s2prot.Struct{"0": index, "1": int64(0), "2": int64(0), "3": int64(600), "4": int64(800)}
+}
+
+func testDepotLink(typ string, hash byte) string {
+	return typ + "US\x00\x00" + strings.Repeat(string([]byte{hash}), 32)
+}
+
+func testAttributeLink(id int64) s2prot.Struct {
+	return s2prot.Struct{"0": int64(999), "1": id}
+}
+
+// testS2MH returns a synthetic unlabeled s2mh of version 24.
+func testS2MH() s2prot.Struct {
+	localeTable := []interface{}{
+		s2prot.Struct{"0": "enUS", "1": []interface{}{testDepotLink("s2ml", 0xab)}},
+		s2prot.Struct{"0": "deDE", "1": []interface{}{testDepotLink("s2ml", 0xcd)}},
+	}
+	return s2prot.Struct{
+		"0": s2prot.Struct{
+			"0": s2prot.Struct{"0": int64(289177), "1": int64(65568)},
+			"1": "ColdVoyage.SC2Map",
+			"2": testDepotLink("s2ma", 0x70),
+			"3": int64(362949),
+			"4": s2prot.Struct{
+				"0":  testLocKey(1),
+				"1":  testLocKey(2),
+				"2":  nil,
+				"3":  testPicture(0),
+				"4":  int64(10),
+				"5":  int64(22),
+				"6":  []interface{}{s2prot.Struct{"0": testAttributeLink(3007), "1": []interface{}{s2prot.Struct{"0": int64(1), "1": int64(0)}, s2prot.Struct{"0": int64(0), "1": int64(0)}}}},
+				"7":  []interface{}{testDepotLink("s2mv", 0xab)},
+				"8":  localeTable,
+				"9":  []interface{}{},
+				"10": []interface{}{},
+				"11": []interface{}{s2prot.Struct{"0": testAttributeLink(3004), "1": int64(1011), "2": []interface{}{s2prot.Struct{"0": "\x00Lic", "1": int64(162)}}}},
+			},
+			"5": []interface{}{s2prot.Struct{
+				"0": testAttributeLink(2000),
+				"1": []interface{}{s2prot.Struct{"0": "Val\x00", "1": s2prot.Struct{"0": testLocKey(3), "1": testLocKey(0), "2": testPicture(4)}, "2": []interface{}{}}},
+				"2": s2prot.Struct{"0": testLocKey(5), "1": testLocKey(0), "2": testPicture(6)},
+				"3": []interface{}{},
+				"4": int64(1),
+				"5": int64(3),
+				"6": int64(2),
+				"7": int64(0x02),
+				"8": s2prot.Struct{"0": int64(0), "1": int64(0)},
+				"9": int64(7),
+			}},
+			"6":  []interface{}{},
+			"7":  []interface{}{},
+			"8":  localeTable,
+			"9":  s2prot.Struct{"0": int64(256), "1": int64(256)},
+			"10": testLocKey(7),
+			"11": nil,
+			"12": int64(0),
+			"13": []interface{}{s2prot.Struct{
+				"0":  s2prot.Struct{"0": int64(1), "1": int64(2)},
+				"1":  testLocKey(8),
+				"2":  testLocKey(9),
+				"3":  testLocKey(10),
+				"4":  testLocKey(11),
+				"5":  s2prot.Struct{"0": int64(0), "1": int64(0), "2": int64(0)},
+				"6":  []interface{}{s2prot.Struct{"0": testAttributeLink(2000), "1": s2prot.Struct{"0": int64(0), "1": int64(0)}}},
+				"7":  []interface{}{s2prot.Struct{"0": testAttributeLink(2018), "1": s2prot.BitArr{Count: 16, Data: []byte{0xff, 0x03}}}},
+				"8":  int64(5),
+				"9":  []interface{}{s2prot.Struct{"0": testAttributeLink(3006), "1": int64(1)}},
+				"10": []interface{}{},
+				"11": []interface{}{"Ach\x00"},
+				"12": int64(10),
+				"13": int64(16),
+				"14": nil,
+				"15": []interface{}{testLocKey(12), testLocKey(13)},
+			}},
+			"14": []interface{}{s2prot.Struct{"0": int64(288191), "1": int64(0)}},
+			"15": int64(1),
+			"16": []interface{}{s2prot.Struct{"0": "Perm\x00", "1": int64(5)}},
+			"17": []interface{}{},
+			"18": []interface{}{"BLIZ", "FEAT"},
+			"19": s2prot.Struct{
+				"0": []interface{}{},
+				"1": []interface{}{},
+				"2": []interface{}{s2prot.Struct{"0": testPicture(14), "1": testLocKey(15)}},
+				"3": []interface{}{},
+				"4": s2prot.Struct{
+					"0": []interface{}{
+						s2prot.Struct{"0": testLocKey(16), "1": int64(0), "2": int64(0), "3": testLocKey(0)},
+						s2prot.Struct{"0": testLocKey(17), "1": int64(2), "2": int64(2), "3": testLocKey(0)},
+					},
+					"1": []interface{}{testLocKey(18), testLocKey(19), testLocKey(20)},
+				},
+				"5": s2prot.Struct{"0": []interface{}{}, "1": []interface{}{}},
+				"6": testPicture(21),
+				"7": nil,
+				"8": []interface{}{},
+				"9": testLocKey(22),
+			},
+			"20": []interface{}{},
+			"21": []interface{}{},
+			"22": int64(0),
+			"23": []interface{}{"SC2ParkVoicePack"},
+			"24": []interface{}{int64(23498)},
+		},
+		"1": int64(0),
+	}
+}
+
+func TestDecodeS2MH(t *testing.T) {
+	data, err := Marshal(testS2MH())
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	hdr, err := DecodeS2MH(data)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if hdr.Header.ID != 289177 || hdr.Header.MajorVersion() != 1 || hdr.Filename != "ColdVoyage.SC2Map" {
+		t.Error("Unexpected value!")
+	}
+	if hdr.ArchiveHandle.Type != "s2ma" || hdr.ArchiveHandle.Region != "us" || len(hdr.ArchiveHandle.Hash) != 64 {
+		t.Error("Unexpected value:", hdr.ArchiveHandle)
+	}
+	if len(hdr.LocaleTable) != 2 || hdr.LocaleTable[1].Locale != "deDE" || hdr.LocaleTable[1].StringTable[0].Type != "s2ml" {
+		t.Error("Unexpected value!")
+	}
+	if hdr.WorkingSet.Name == nil || hdr.WorkingSet.Name.Index != 1 || hdr.WorkingSet.Thumbnail != nil {
+		t.Error("Unexpected value!")
+	}
+	if v := hdr.WorkingSet.Instances[0].Value; !v.PerSlot || len(v.Values) != 2 || v.Values[0].Index != 1 {
+		t.Error("Unexpected value:", v)
+	}
+	if a := hdr.Attributes[0]; a.Values[0].Value != "Val" || a.Default.PerSlot || a.Default.Values[0].Index != 0 || a.SortOrder != 7 {
+		t.Error("Unexpected value!")
+	}
+	v := hdr.Variants[0]
+	if v.ModeID != 2 || v.LockedAttributes[0].LockedScopes != 0xff03 || *v.MaxOpenSlots != 16 || v.PremiumInfo != nil || len(v.TeamNames) != 2 {
+		t.Error("Unexpected value!")
+	}
+	if hdr.ArcadeInfo == nil || len(hdr.ArcadeInfo.HowToPlaySections) != 2 || len(hdr.ArcadeInfo.HowToPlaySections[1].Items) != 1 {
+		t.Error("Unexpected value!")
+	}
+	if !hdr.AddDefaultPermissions || hdr.AddMultiMod || hdr.RelevantPermissions[0].Name != "Perm" || len(hdr.SpecialTags) != 2 {
+		t.Error("Unexpected value!")
+	}
+	if len(hdr.VoicePacks) != 1 || hdr.VoicePacks[0] != "SC2ParkVoicePack" || len(hdr.RewardIDs) != 1 || hdr.RewardIDs[0] != 23498 {
+		t.Error("Unexpected value!")
+	}
+	if hdr.Attributes[0].Requirements == nil {
+		t.Error("Unexpected value!")
+	}
+	if l := hdr.WorkingSet.Licenses; len(l) != 1 || l[0].Attribute.ID != 3004 || l[0].Value != 1011 || l[0].Licenses[0] != (License{"Lic", 162}) {
+		t.Error("Unexpected value:", l)
+	}
+
+	if _, err := NewMapHeader(s2prot.Struct{"variants": []interface{}{s2prot.Struct{"modeId": "2"}}}); !errors.Is(err, errTypeMismatch) || !strings.Contains(err.Error(), "/variants/0/modeId") {
+		t.Error("Unexpected error:", err)
+	}
+}
+
+func TestDecodeS2MHAttributeRestrictions(t *testing.T) {
+	unlabeled := testS2MH()
+	s2mh := unlabeled.Structv("0")
+	s2mh["13"].([]interface{})[0].(s2prot.Struct)["10"] = []interface{}{s2prot.Struct{
+		"0": testAttributeLink(500),
+		"1": s2prot.Struct{"0": []interface{}{s2prot.BitArr{Count: 8, Data: []byte{0x0f}}, s2prot.BitArr{Count: 10, Data: []byte{0x02, 0x01}}, int64(6)}},
+	}}
+	s2mh["23"] = []interface{}{"SC2ParkVoicePack\x00"}
+	data, err := Marshal(unlabeled)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	hdr, err := DecodeS2MH(data)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if r := hdr.Variants[0].AttributeRestrictions; len(r) != 1 || r[0].Attribute.ID != 500 || !reflect.DeepEqual(r[0].AllowedSlots, [][]int64{{0, 1, 2, 3}, {0, 9}, {1, 2}}) {
+		t.Error("Unexpected value:", r)
+	}
+	if !reflect.DeepEqual(hdr.VoicePacks, []string{"SC2ParkVoicePack"}) {
+		t.Error("Unexpected value:", hdr.VoicePacks)
+	}
+}
+
+func TestReadS2MHRawFields(t *testing.T) {
+	unlabeled := testS2MH()
+	s2mh := unlabeled.Structv("0")
+	s2mh["6"] = []interface{}{int64(6)}
+	s2mh["7"] = []interface{}{s2prot.Struct{"0": int64(1), "1": "Score\x00"}, s2prot.Struct{"0": int64(2), "1": "Kill", "2": int64(0)}}
+	s2mh["17"] = s2prot.Struct{"0": int64(17)}
+	s2mh["20"] = int64(20)
+	s2mh["21"] = nil
+	labeled, err := ReadS2MH(unlabeled)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	expected := []interface{}{
+		s2prot.Struct{"id": int64(1), "name": "Score"},
+		s2prot.Struct{"id": int64(2), "name": "Kill", "_unknown": s2prot.Struct{"2": int64(0)}},
+	}
+	if !reflect.DeepEqual(labeled["resultDefinitions"], expected) {
+		t.Error("Unexpected value:", labeled["resultDefinitions"])
+	}
+	// Fields not understood yet are kept under "_unknown", absent ones are left out
+	unknown := s2prot.Struct{"6": []interface{}{int64(6)}, "17": s2prot.Struct{"0": int64(17)}, "20": int64(20)}
+	if !reflect.DeepEqual(labeled["_unknown"], unknown) {
+		t.Error("Unexpected value:", labeled["_unknown"])
+	}
+	hdr, err := NewMapHeader(labeled)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if r := hdr.ResultDefinitions; len(r) != 2 || r[0].ID != 1 || r[0].Name != "Score" || !reflect.DeepEqual(r[1].Unknown, s2prot.Struct{"2": int64(0)}) {
+		t.Error("Unexpected value:", r)
+	}
+	if !reflect.DeepEqual(hdr.Unknown, unknown) {
+		t.Error("Unexpected value:", hdr.Unknown)
+	}
+
+	// Fields of later versions are not kept
+	for _, tag := range []string{"19", "20", "21", "22", "23", "24"} {
+		delete(s2mh, tag)
+	}
+	if labeled, err = ReadS2MH(unlabeled); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if unknown := labeled.Structv("_unknown"); len(unknown) != 2 || unknown["17"] == nil {
+		t.Error("Unexpected value:", unknown)
+	}
+}
@@ -0,0 +1,89 @@
+// Strongly typed model of the labeled s2mi.
+
+package s2mdec
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/icza/s2prot"
+)
+
+// MapInfo is the typed form of the labeled s2mi returned by ReadS2MI.
+// JSON field names are the same as the keys of the labeled s2mi,
+// timestamps are converted from seconds since the Unix epoch to time.Time (zero if not set).
+type MapInfo struct {
+	Header                 InstanceHeader `json:"header"`
+	HeaderCacheHandle      DepotLink      `json:"headerCacheHandle"`
+	UploadTime             time.Time      `json:"uploadTime"`
+	IsLinked               bool           `json:"isLinked"`
+	IsLocked               bool           `json:"isLocked"`
+	IsPrivate              bool           `json:"isPrivate"`
+	MapSize                int64          `json:"mapSize"`
+	Name                   string         `json:"name"`
+	IsMod                  bool           `json:"isMod"`
+	AuthorToonName         ToonName       `json:"authorToonName"`
+	IsLatestVersion        bool           `json:"isLatestVersion"`
+	MainLocale             string         `json:"mainLocale"`
+	AuthorToonHandle       ToonHandle     `json:"authorToonHandle"`
+	IsSkipInitialDownload  bool           `json:"isSkipInitialDownload"`
+	CreatedTime            time.Time      `json:"createdTime"`
+	Labels                 []interface{}  `json:"labels"` // element type is not known yet
+	IsMelee                bool           `json:"isMelee"`
+	IsCluster              bool           `json:"isCluster"`
+	ClusterParent          int64          `json:"clusterParent"`
+	ClusterChildren        []interface{}  `json:"clusterChildren"` // element type is not known yet
+	IsHiddenLobby          bool           `json:"isHiddenLobby"`
+	IsExtensionMod         bool           `json:"isExtensionMod"`
+	TransitionID           int64          `json:"transitionId"`           // ver >= 24
+	LastPublishTime        time.Time      `json:"lastPublishTime"`        // ver >= 24
+	FirstPublicPublishTime time.Time      `json:"firstPublicPublishTime"` // ver >= 24
+}
+
+// ToonName identifies a player by the BattleTag.
+type ToonName struct {
+	RegionID  int64  `json:"regionId"`
+	App       string `json:"app"`
+	RealmID   int64  `json:"realmId"`
+	BattleTag string `json:"battleTag"`
+}
+
+// ToonHandle identifies a player by the profile.
+type ToonHandle struct {
+	RegionID  int64  `json:"regionId"`
+	App       string `json:"app"`
+	RealmID   int64  `json:"realmId"`
+	ProfileID int64  `json:"profileId"`
+}
+
+// String returns the toon handle in its usual form, e.g. "2-S2-1-1234567".
+func (h ToonHandle) String() string {
+	return strconv.FormatInt(h.RegionID, 10) + "-" + h.App + "-" + strconv.FormatInt(h.RealmID, 10) + "-" + strconv.FormatInt(h.ProfileID, 10)
+}
+
+// unixTime converts seconds since the Unix epoch to time.Time, 0 being the zero time.
+func unixTime(sec int64) time.Time {
+	if sec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(sec, 0).UTC()
+}
+
+// NewMapInfo converts the labeled s2mi returned by ReadS2MI to MapInfo.
+func NewMapInfo(labeled s2prot.Struct) (*MapInfo, error) {
+	info := &MapInfo{}
+	if err := fromLabeled(labeled, info); err != nil {
+		return nil, fmt.Errorf("s2mi: %w", err)
+	}
+	return info, nil
+}
+
+// DecodeS2MI decodes and labels the contents of an s2mi file.
+func DecodeS2MI(data []byte) (*MapInfo, error) {
+	labeled, err := decodeLabeled(data, ReadS2MI)
+	if err != nil {
+		return nil, err
+	}
+	return NewMapInfo(labeled)
+}
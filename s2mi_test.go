@@ -0,0 +1,66 @@
+package s2mdec
+
+import (
+	"testing"
+	"time"
+
+	"github.com/icza/s2prot"
+)
+
+// testS2MI returns a synthetic unlabeled s2mi of version 26.
+func testS2MI() s2prot.Struct {
+	return s2prot.Struct{
+		"0": s2prot.Struct{
+			"0":  s2prot.Struct{"0": int64(289177), "1": int64(65568)},
+			"1":  testDepotLink("s2mh", 0x39),
+			"2":  int64(1594829063),
+			"3":  int64(1),
+			"4":  int64(0),
+			"5":  int64(0),
+			"6":  int64(1234567),
+			"7":  "ColdVoyage",
+			"8":  s2prot.Struct{"0": int64(0), "1": int64(0)},
+			"9":  int64(0),
+			"11": s2prot.Struct{"0": int64(2), "1": "S2\x00\x00", "2": int64(1), "3": "Author#1234"},
+			"12": int64(1),
+			"13": "enUS",
+			"14": s2prot.Struct{"0": int64(2), "1": "S2\x00\x00", "2": int64(1), "3": int64(1234567)},
+			"15": int64(0),
+			"16": int64(1594000000),
+			"17": []interface{}{},
+			"18": int64(0),
+			"19": int64(0),
+			"20": int64(0),
+			"21": []interface{}{},
+			"22": int64(0),
+			"23": int64(1),
+			"24": int64(0),
+			"25": int64(1594829063),
+			"26": int64(0),
+		},
+		"1": int64(0),
+	}
+}
+
+func TestDecodeS2MI(t *testing.T) {
+	data, err := Marshal(testS2MI())
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	info, err := DecodeS2MI(data)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if info.Header.ID != 289177 || info.HeaderCacheHandle.Type != "s2mh" || info.Name != "ColdVoyage" || !info.IsLinked || !info.IsExtensionMod {
+		t.Error("Unexpected value!")
+	}
+	if !info.UploadTime.Equal(time.Date(2020, 7, 15, 16, 4, 23, 0, time.UTC)) || !info.LastPublishTime.Equal(info.UploadTime) {
+		t.Error("Unexpected value:", info.UploadTime)
+	}
+	if !info.FirstPublicPublishTime.IsZero() {
+		t.Error("Unexpected value:", info.FirstPublicPublishTime)
+	}
+	if info.AuthorToonName.BattleTag != "Author#1234" || info.AuthorToonHandle.String() != "2-S2-1-1234567" {
+		t.Error("Unexpected value!")
+	}
+}
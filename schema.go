@@ -0,0 +1,964 @@
+// Declarative schema of the s2mh and s2mi structs, and the generic labeler applying it.
+
+package s2mdec
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/icza/s2prot"
+)
+
+// FieldType tells how an unlabeled value is labeled.
+type FieldType string
+
+// FieldType consts.
+const (
+	TypeAny           FieldType = "any"           // Value as is, e.g. optional or not yet understood values
+	TypeInt           FieldType = "int"           // Integer
+	TypeBool          FieldType = "bool"          // Integer, true if not zero
+	TypeStrictBool    FieldType = "strictBool"    // Integer, 0 or 1
+	TypeString        FieldType = "string"        // Blob as is
+	TypeTrimmedString FieldType = "trimmedString" // Blob with the \x00 padding trimmed
+	TypeDepotLink     FieldType = "depotLink"     // Blob of a depot link, labeled as a struct of type, region and hash
+	TypeBitMask16     FieldType = "bitMask16"     // Bit array of 16 bits, labeled as a big endian integer
+	TypeSlots         FieldType = "slots"         // Bit array or integer with a bit per lobby slot, labeled as the indices of the set bits
+	TypeStruct        FieldType = "struct"        // Struct labeled by Schema, as is if Schema is empty
+	TypeStructOrArray FieldType = "structOrArray" // Struct, or an array of structs, labeled by Schema
+	TypeArray         FieldType = "array"         // Array whose elements are labeled by Elem, as is if Elem is nil
+	TypeSections      FieldType = "sections"      // Struct labeled by Schema into headers and items, labeled as the headers holding their items
+	TypeTags          FieldType = "tags"          // Blob, or an array of blobs with the \x00 padding trimmed, labeled as an array
+)
+
+// kind returns the kinds of unlabeled values the FieldType labels, see LabelError.
+func (t FieldType) kind() string {
+	switch t {
+	case TypeInt, TypeBool, TypeStrictBool:
+		return "int"
+	case TypeString, TypeTrimmedString, TypeDepotLink:
+		return "blob"
+	case TypeBitMask16:
+		return "bitArray"
+	case TypeSlots:
+		return "bitArray or int"
+	case TypeStruct, TypeSections:
+		return "struct"
+	case TypeStructOrArray:
+		return "struct or array"
+	case TypeArray:
+		return "array"
+	case TypeTags:
+		return "blob or array"
+	}
+	return "" // any
+}
+
+// accepts tells if the FieldType labels v, a missing value being labeled as the zero value.
+func (t FieldType) accepts(v interface{}) bool {
+	actual, expected := kindOf(v), t.kind()
+	if actual == "nil" || expected == "" {
+		return true
+	}
+	for _, k := range strings.Split(expected, " or ") {
+		if k == actual {
+			return true
+		}
+	}
+	return false
+}
+
+// kindOf returns the kind of an unlabeled value, see LabelError.
+func kindOf(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "nil"
+	case int64:
+		return "int"
+	case string:
+		return "blob"
+	case s2prot.Struct:
+		if v == nil {
+			return "nil"
+		}
+		return "struct"
+	case []interface{}:
+		return "array"
+	case s2prot.BitArr:
+		return "bitArray"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// Schema describes how an unlabeled struct is labeled.
+//
+// The version of an unlabeled struct is its greatest field tag. Fields are labeled
+// in the order they are listed, fields whose version range does not include the version are skipped.
+type Schema struct {
+	Name        string  `json:"name"`
+	Versions    []int   `json:"versions,omitempty"`    // Versions allowed, any if empty
+	Len         int     `json:"len,omitempty"`         // Number of fields required, any if 0
+	KeepUnknown bool    `json:"keepUnknown,omitempty"` // Tells to keep unknown fields under "_unknown" without warning
+	Fields      []Field `json:"fields"`
+}
+
+// Field describes a field of a Schema, or the elements of an array field.
+type Field struct {
+	Path       string    `json:"path,omitempty"`       // Field tags and array indices separated by dots, e.g. "0" or "2.0.1"
+	Label      string    `json:"label,omitempty"`      // Key of the labeled field, the field is only checked if empty
+	Unknown    bool      `json:"unknown,omitempty"`    // Tells the field is not understood yet, it is kept as is under "_unknown" keyed by Path
+	Type       FieldType `json:"type"`                 // How the value is labeled
+	Schema     string    `json:"schema,omitempty"`     // Schema of TypeStruct, TypeStructOrArray and TypeSections values
+	Elem       *Field    `json:"elem,omitempty"`       // Elements of TypeArray values
+	Optional   bool      `json:"optional,omitempty"`   // Tells if a missing struct is labeled as nil
+	MinVersion int       `json:"minVersion,omitempty"` // Version of the struct the field appears in
+	MaxVersion int       `json:"maxVersion,omitempty"` // Last version of the struct the field appears in, no limit if 0
+	Len        *int      `json:"len,omitempty"`        // Length required of a struct, or expected of an array
+	Equals     *int64    `json:"equals,omitempty"`     // Value expected of an integer
+	OneOf      []string  `json:"oneOf,omitempty"`      // Values expected of a string or of the elements of tags
+}
+
+// String returns the indented JSON representation of the Schema.
+func (s *Schema) String() string {
+	b, _ := json.MarshalIndent(s, "", "  ")
+	return string(b)
+}
+
+// versioned tells if labeling needs the version of the struct.
+func (s *Schema) versioned() bool {
+	if len(s.Versions) > 0 {
+		return true
+	}
+	for _, f := range s.Fields {
+		if f.MinVersion > 0 || f.MaxVersion > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// inVersion tells if the field appears in version ver of the struct.
+func (f *Field) inVersion(ver int) bool {
+	return ver >= f.MinVersion && (f.MaxVersion == 0 || ver <= f.MaxVersion)
+}
+
+// Schemas is the registry of the schemas used by ReadS2MH, ReadS2MI and ReadS2GS keyed by name.
+// The root schemas are "s2mh", "s2mi" and "s2gs". Supporting a new version of a struct is a change of its Schema.
+var Schemas = newSchemas(
+	&Schema{Name: "s2mh", Versions: []int{13, 14, 18, 22, 23, 24}, Fields: []Field{
+		{Path: "0", Label: "header", Type: TypeStruct, Schema: "instanceHeader"},
+		{Path: "1", Label: "filename", Type: TypeString}, // utf8
+		{Path: "2", Label: "archiveHandle", Type: TypeDepotLink},
+		{Path: "3", Label: "mapNamespace", Type: TypeInt},
+		{Path: "4", Label: "workingSet", Type: TypeStruct, Schema: "workingSet"},
+		{Path: "5", Label: "attributes", Type: TypeArray, Elem: &Field{Type: TypeStruct, Schema: "attributeDefinition"}},
+		{Path: "6", Type: TypeAny, Unknown: true},
+		{Path: "7", Label: "resultDefinitions", Type: TypeArray, Elem: &Field{Type: TypeStruct, Schema: "resultDefinition"}},
+		{Path: "8", Label: "localeTable", Type: TypeArray, Elem: &Field{Type: TypeStruct, Schema: "localizationLink"}},
+		{Path: "9", Label: "mapSize", Type: TypeStruct, Schema: "mapSize", Optional: true},
+		{Path: "10", Label: "tileset", Type: TypeStruct, Schema: "localizationTableKey", Optional: true},
+		{Path: "11", Label: "specialTags", Type: TypeTags, OneOf: knownSpecialTags, MaxVersion: 17},
+		{Path: "12", Label: "defaultVariantIndex", Type: TypeInt},
+		{Path: "13", Label: "variants", Type: TypeArray, Elem: &Field{Type: TypeStruct, Schema: "variantInfo"}},
+		{Path: "14", Label: "extraDependencies", Type: TypeArray, Elem: &Field{Type: TypeStruct, Schema: "instanceHeader"}, MinVersion: 14},
+		{Path: "15", Label: "addDefaultPermissions", Type: TypeStrictBool, MinVersion: 18},
+		{Path: "16", Label: "relevantPermissions", Type: TypeArray, Elem: &Field{Type: TypeStruct, Schema: "permission"}, MinVersion: 18},
+		{Path: "17", Type: TypeAny, Unknown: true, MinVersion: 18},
+		{Path: "18", Label: "specialTags", Type: TypeArray, Elem: &Field{Type: TypeTrimmedString, OneOf: knownSpecialTags}, MinVersion: 18},
+		{Path: "19", Label: "arcadeInfo", Type: TypeStruct, Schema: "arcadeInfo", Optional: true, MinVersion: 22},
+		{Path: "20", Type: TypeAny, Unknown: true, MinVersion: 22},
+		{Path: "21", Type: TypeAny, Unknown: true, MinVersion: 22},
+		{Path: "22", Label: "addMultiMod", Type: TypeStrictBool, MinVersion: 22},
+		{Path: "23", Label: "voicePacks", Type: TypeArray, Elem: &Field{Type: TypeTrimmedString}, MinVersion: 23}, // e.g. ["SC2ParkVoicePack"]
+		{Path: "24", Label: "rewardIds", Type: TypeArray, Elem: &Field{Type: TypeInt}, MinVersion: 24},            // possibly reward IDs
+	}},
+	&Schema{Name: "s2mi", Versions: []int{22, 23, 26}, Fields: []Field{
+		{Path: "0", Label: "header", Type: TypeStruct, Schema: "instanceHeader"},
+		{Path: "1", Label: "headerCacheHandle", Type: TypeDepotLink},
+		{Path: "2", Label: "uploadTime", Type: TypeInt},
+		{Path: "3", Label: "isLinked", Type: TypeBool},
+		{Path: "4", Label: "isLocked", Type: TypeBool},
+		{Path: "5", Label: "isPrivate", Type: TypeBool},
+		{Path: "6", Label: "mapSize", Type: TypeInt},
+		{Path: "7", Label: "name", Type: TypeString},
+		{Path: "8", Type: TypeStruct, Len: intPtr(2)}, // profileRecordAddress?
+		{Path: "9", Label: "isMod", Type: TypeBool},
+		{Path: "11", Label: "authorToonName", Type: TypeStruct, Schema: "toonName"},
+		{Path: "12", Label: "isLatestVersion", Type: TypeBool},
+		{Path: "13", Label: "mainLocale", Type: TypeString},
+		{Path: "14", Label: "authorToonHandle", Type: TypeStruct, Schema: "toonHandle"},
+		{Path: "15", Label: "isSkipInitialDownload", Type: TypeBool},
+		{Path: "16", Label: "createdTime", Type: TypeInt},
+		{Path: "17", Label: "labels", Type: TypeArray},
+		{Path: "18", Label: "isMelee", Type: TypeBool},
+		{Path: "19", Label: "isCluster", Type: TypeBool},
+		{Path: "20", Label: "clusterParent", Type: TypeInt},
+		{Path: "21", Label: "clusterChildren", Type: TypeArray},
+		{Path: "22", Label: "isHiddenLobby", Type: TypeBool},
+		{Path: "23", Label: "isExtensionMod", Type: TypeBool},
+		{Path: "24", Label: "transitionId", Type: TypeInt, MinVersion: 24},
+		{Path: "25", Label: "lastPublishTime", Type: TypeInt, MinVersion: 24},
+		{Path: "26", Label: "firstPublicPublishTime", Type: TypeInt, MinVersion: 24},
+	}},
+	// s2gs is the first instance of the game summary, the layout is the one read by sc2reader.
+	// The s2gs schemas only know part of the fields, the other ones are kept under "_unknown".
+	&Schema{Name: "s2gs", KeepUnknown: true, Fields: []Field{
+		{Path: "0.1", Label: "gameSpeed", Type: TypeTrimmedString}, // e.g. "Fasr"
+		{Path: "2", Label: "map", Type: TypeStruct, Schema: "s2gsMap"},
+		// a player for each slot in lobby
+		{Path: "3", Label: "players", Type: TypeArray, Elem: &Field{Type: TypeStruct, Schema: "s2gsPlayer"}},
+		{Path: "5", Label: "attributes", Type: TypeArray, Elem: &Field{Type: TypeStruct, Schema: "attributeDefinition"}},
+		// instances are the values of the attributes in lobby
+		{Path: "6", Label: "workingSet", Type: TypeStruct, Schema: "workingSet"},
+		{Path: "7", Label: "gameDuration", Type: TypeInt}, // game seconds
+		{Path: "8", Label: "startTime", Type: TypeInt},    // seconds since the Unix epoch
+	}},
+	&Schema{Name: "instanceHeader", Len: 2, Fields: []Field{
+		{Path: "0", Label: "id", Type: TypeInt},
+		{Path: "1", Label: "version", Type: TypeInt}, // major version << 16 | minor version
+	}},
+	&Schema{Name: "localizationLink", Fields: []Field{
+		{Path: "0", Label: "locale", Type: TypeString},
+		{Path: "1", Label: "stringTable", Type: TypeArray, Elem: &Field{Type: TypeDepotLink}},
+	}},
+	&Schema{Name: "localizationTableKey", Len: 3, Fields: []Field{
+		{Path: "0", Label: "color", Type: TypeAny}, // optional: int or nil
+		{Path: "1", Label: "table", Type: TypeInt},
+		{Path: "2", Label: "index", Type: TypeInt},
+	}},
+	&Schema{Name: "picture", Len: 5, Fields: []Field{
+		{Path: "0", Label: "index", Type: TypeInt},
+		{Path: "1", Label: "top", Type: TypeInt},
+		{Path: "2", Label: "left", Type: TypeInt},
+		{Path: "3", Label: "height", Type: TypeInt},
+		{Path: "4", Label: "width", Type: TypeInt},
+	}},
+	&Schema{Name: "mapSize", Fields: []Field{
+		{Path: "0", Label: "horizontal", Type: TypeInt},
+		{Path: "1", Label: "vertical", Type: TypeInt},
+	}},
+	&Schema{Name: "workingSet", Versions: []int{8, 10, 11}, Fields: []Field{
+		{Path: "0", Label: "name", Type: TypeStruct, Schema: "localizationTableKey", Optional: true},
+		{Path: "1", Label: "description", Type: TypeStruct, Schema: "localizationTableKey", Optional: true},
+		{Path: "2", Label: "thumbnail", Type: TypeStruct, Schema: "picture", Optional: true},
+		{Path: "3", Label: "bigMap", Type: TypeStruct, Schema: "picture", Optional: true},
+		{Path: "4", Label: "maxPlayers", Type: TypeInt},
+		{Path: "5", Type: TypeInt, Equals: int64Ptr(22)},
+		{Path: "6", Label: "instances", Type: TypeArray, Elem: &Field{Type: TypeStruct, Schema: "variantAttributeDefaults"}},
+		{Path: "7", Label: "visualFiles", Type: TypeArray, Elem: &Field{Type: TypeDepotLink}},
+		{Path: "8", Label: "localeTable", Type: TypeArray, Elem: &Field{Type: TypeStruct, Schema: "localizationLink"}},
+		{Path: "9", Type: TypeArray, Len: intPtr(0), MinVersion: 10},
+		{Path: "10", Type: TypeArray, Len: intPtr(0), MinVersion: 10},
+		{Path: "11", Label: "licenses", Type: TypeArray, Elem: &Field{Type: TypeStruct, Schema: "licenseRequirement"}, MinVersion: 11},
+	}},
+	&Schema{Name: "attributeLink", Len: 2, Fields: []Field{
+		{Path: "0", Label: "namespace", Type: TypeInt},
+		{Path: "1", Label: "id", Type: TypeInt},
+	}},
+	&Schema{Name: "attributeVisual", Len: 3, Fields: []Field{
+		{Path: "0", Label: "text", Type: TypeStruct, Schema: "localizationTableKey", Optional: true},
+		{Path: "1", Label: "tip", Type: TypeStruct, Schema: "localizationTableKey", Optional: true},
+		{Path: "2", Label: "art", Type: TypeStruct, Schema: "picture", Optional: true},
+	}},
+	&Schema{Name: "attributeValueDefinition", Versions: []int{1, 2}, Fields: []Field{
+		{Path: "0", Label: "value", Type: TypeTrimmedString},
+		{Path: "1", Label: "visual", Type: TypeStruct, Schema: "attributeVisual"},
+		{Path: "2", Type: TypeArray, Len: intPtr(0), MinVersion: 2},
+	}},
+	&Schema{Name: "attributeDefinition", Fields: []Field{
+		{Path: "0", Label: "instance", Type: TypeStruct, Schema: "attributeLink"},
+		{Path: "1", Label: "values", Type: TypeArray, Elem: &Field{Type: TypeStruct, Schema: "attributeValueDefinition"}},
+		{Path: "2", Label: "visual", Type: TypeStruct, Schema: "attributeVisual"},
+		{Path: "3", Label: "_requirements", Type: TypeAny}, // unknown type, kept raw
+		{Path: "4", Label: "arbitration", Type: TypeInt},   // 0: always, 1: first come first serve
+		{Path: "5", Label: "visibility", Type: TypeInt},    // 0: none, 1: self, 2: host, 3: all
+		{Path: "6", Label: "access", Type: TypeInt},        // 0: none, 1: self, 2: host, 3: all
+		{Path: "7", Label: "options", Type: TypeInt},       // 0x01: unknown, 0x02: locked when public, 0x04: hidden
+		{Path: "8", Label: "default", Type: TypeStructOrArray, Schema: "attributeDefaultValue"},
+		{Path: "9", Label: "sortOrder", Type: TypeInt},
+	}},
+	&Schema{Name: "attributeDefaultValue", Len: 2, Fields: []Field{
+		{Path: "0", Label: "index", Type: TypeInt},
+		{Path: "1", Type: TypeAny}, // _unk_attr_val_1
+	}},
+	&Schema{Name: "variantAttributeDefaults", Len: 2, Fields: []Field{
+		{Path: "0", Label: "attribute", Type: TypeStruct, Schema: "attributeLink"},
+		{Path: "1", Label: "value", Type: TypeStructOrArray, Schema: "attributeDefaultValue"},
+	}},
+	&Schema{Name: "variantAttributeLocked", Len: 2, Fields: []Field{
+		{Path: "0", Label: "attribute", Type: TypeStruct, Schema: "attributeLink"},
+		{Path: "1", Label: "lockedScopes", Type: TypeBitMask16}, // bit for each slot in lobby
+	}},
+	&Schema{Name: "variantAttributeVisibility", Len: 2, Fields: []Field{
+		{Path: "0", Label: "attribute", Type: TypeStruct, Schema: "attributeLink"},
+		{Path: "1", Label: "hidden", Type: TypeInt},
+	}},
+	&Schema{Name: "variantAttributeRestriction", Fields: []Field{
+		{Path: "0", Label: "attribute", Type: TypeStruct, Schema: "attributeLink"},
+		// 1: {0: [8, 8, 8, 8]}, a bit array of slots for each value of the attribute
+		{Path: "1.0", Label: "allowedSlots", Type: TypeArray, Elem: &Field{Type: TypeSlots}},
+	}},
+	&Schema{Name: "licenseRequirement", Fields: []Field{
+		// {0: {0: 999, 1: 3004}, 1: 1011, 2: [{0: b'\x00Lic', 1: 162}]}
+		{Path: "0", Label: "attribute", Type: TypeStruct, Schema: "attributeLink"},
+		{Path: "1", Label: "value", Type: TypeInt},
+		{Path: "2", Label: "licenses", Type: TypeArray, Elem: &Field{Type: TypeStruct, Schema: "license"}},
+	}},
+	&Schema{Name: "license", Fields: []Field{
+		{Path: "0", Label: "name", Type: TypeTrimmedString},
+		{Path: "1", Label: "id", Type: TypeInt},
+	}},
+	&Schema{Name: "premiumInfo", Versions: []int{0}, Fields: []Field{
+		{Path: "0", Label: "license", Type: TypeInt},
+	}},
+	&Schema{Name: "variantInfo", Versions: []int{8, 11, 12, 13, 14, 15}, Fields: []Field{
+		{Path: "0", Type: TypeStruct, Len: intPtr(2)},
+		{Path: "5", Type: TypeStruct, Len: intPtr(3)},
+		{Path: "0.0", Label: "categoryId", Type: TypeInt},
+		{Path: "0.1", Label: "modeId", Type: TypeInt},
+		{Path: "1", Label: "categoryName", Type: TypeStruct, Schema: "localizationTableKey", Optional: true},
+		{Path: "2", Label: "modeName", Type: TypeStruct, Schema: "localizationTableKey", Optional: true},
+		{Path: "3", Label: "categoryDescription", Type: TypeStruct, Schema: "localizationTableKey", Optional: true},
+		{Path: "4", Label: "modeDescription", Type: TypeStruct, Schema: "localizationTableKey", Optional: true},
+		{Path: "6", Label: "attributeDefaults", Type: TypeArray, Elem: &Field{Type: TypeStruct, Schema: "variantAttributeDefaults"}},
+		{Path: "7", Label: "lockedAttributes", Type: TypeArray, Elem: &Field{Type: TypeStruct, Schema: "variantAttributeLocked"}},
+		{Path: "8", Label: "maxTeamSize", Type: TypeInt},
+		{Path: "9", Label: "attributeVisibility", Type: TypeArray, Elem: &Field{Type: TypeStruct, Schema: "variantAttributeVisibility"}, MinVersion: 11},
+		{Path: "10", Label: "attributeRestrictions", Type: TypeArray, Elem: &Field{Type: TypeStruct, Schema: "variantAttributeRestriction"}, MinVersion: 11},
+		{Path: "11", Label: "achievementTags", Type: TypeArray, Elem: &Field{Type: TypeTrimmedString}, MinVersion: 11},
+		{Path: "12", Label: "maxHumanPlayers", Type: TypeAny, MinVersion: 12}, // optional: int or nil
+		{Path: "13", Label: "maxOpenSlots", Type: TypeAny, MinVersion: 13},    // optional: int or nil
+		{Path: "14", Label: "premiumInfo", Type: TypeStruct, Schema: "premiumInfo", Optional: true, MinVersion: 14},
+		{Path: "15", Label: "teamNames", Type: TypeArray, Elem: &Field{Type: TypeStruct, Schema: "localizationTableKey"}, MinVersion: 15},
+	}},
+	// resultDefinition is a result, e.g. a score, reported by the map, its other fields are kept under "_unknown".
+	&Schema{Name: "resultDefinition", KeepUnknown: true, Fields: []Field{
+		{Path: "0", Label: "id", Type: TypeInt},
+		{Path: "1", Label: "name", Type: TypeTrimmedString}, // e.g. "Score"
+	}},
+	&Schema{Name: "permission", Fields: []Field{
+		{Path: "0", Label: "name", Type: TypeTrimmedString},
+		{Path: "1", Label: "id", Type: TypeInt},
+	}},
+	&Schema{Name: "screenshotEntry", Len: 2, Fields: []Field{
+		{Path: "0", Label: "picture", Type: TypeStruct, Schema: "picture", Optional: true},
+		{Path: "1", Label: "caption", Type: TypeStruct, Schema: "localizationTableKey", Optional: true},
+	}},
+	&Schema{Name: "arcadeSection", Len: 2, Fields: []Field{
+		{Path: "0", Label: "headers", Type: TypeArray, Elem: &Field{Type: TypeStruct, Schema: "arcadeSectionHeader"}},
+		{Path: "1", Label: "items", Type: TypeArray, Elem: &Field{Type: TypeStruct, Schema: "localizationTableKey"}},
+	}},
+	&Schema{Name: "arcadeSectionHeader", Len: 4, Fields: []Field{
+		{Path: "0", Label: "title", Type: TypeStruct, Schema: "localizationTableKey", Optional: true},
+		{Path: "1", Label: "startOffset", Type: TypeInt},
+		{Path: "2", Label: "listType", Type: TypeInt}, // 0: bulleted, 1: numbered, 2: none
+		{Path: "3", Label: "subtitle", Type: TypeStruct, Schema: "localizationTableKey", Optional: true},
+	}},
+	&Schema{Name: "arcadeTutorialLink", Versions: []int{2}, Fields: []Field{
+		{Path: "0", Label: "variantIndex", Type: TypeInt},
+		{Path: "1", Label: "speed", Type: TypeString},
+		// looks like link to map, but it's an array..
+		{Path: "2", Type: TypeArray, Len: intPtr(1)},
+		{Path: "2.0", Type: TypeStruct, Len: intPtr(2)},
+		{Path: "2.0.1", Type: TypeInt, Equals: int64Ptr(0)},
+		{Path: "2.0.0", Label: "map", Type: TypeStruct, Schema: "instanceHeader"},
+	}},
+	&Schema{Name: "arcadeInfo", Versions: []int{9}, Fields: []Field{
+		{Path: "0", Type: TypeArray, Len: intPtr(0)}, // extra visualizationFiles ??
+		{Path: "1", Type: TypeArray, Len: intPtr(0)}, // extra localizationFiles ??
+		{Path: "2", Label: "gameInfoScreenshots", Type: TypeArray, Elem: &Field{Type: TypeStruct, Schema: "screenshotEntry"}},
+		{Path: "3", Label: "howToPlayScreenshots", Type: TypeArray, Elem: &Field{Type: TypeStruct, Schema: "screenshotEntry"}},
+		{Path: "4", Label: "howToPlaySections", Type: TypeSections, Schema: "arcadeSection"},
+		{Path: "5", Label: "patchNoteSections", Type: TypeSections, Schema: "arcadeSection"},
+		{Path: "6", Label: "mapIcon", Type: TypeStruct, Schema: "picture", Optional: true},
+		{Path: "7", Label: "tutorialLink", Type: TypeStruct, Schema: "arcadeTutorialLink", Optional: true},
+		{Path: "8", Label: "matchmakerTags", Type: TypeArray, Elem: &Field{Type: TypeTrimmedString}},
+		{Path: "9", Label: "website", Type: TypeStruct, Schema: "localizationTableKey", Optional: true},
+	}},
+	&Schema{Name: "toonName", Len: 4, Fields: []Field{
+		{Path: "0", Label: "regionId", Type: TypeInt},
+		{Path: "1", Label: "app", Type: TypeTrimmedString},
+		{Path: "2", Label: "realmId", Type: TypeInt},
+		{Path: "3", Label: "battleTag", Type: TypeString},
+	}},
+	&Schema{Name: "toonHandle", Len: 4, Fields: []Field{
+		{Path: "0", Label: "regionId", Type: TypeInt},
+		{Path: "1", Label: "app", Type: TypeTrimmedString},
+		{Path: "2", Label: "realmId", Type: TypeInt},
+		{Path: "3", Label: "profileId", Type: TypeInt},
+	}},
+	&Schema{Name: "s2gsPlayer", KeepUnknown: true, Fields: []Field{
+		{Path: "0.0", Label: "playerId", Type: TypeInt},
+		{Path: "0.1.0", Label: "toonHandle", Type: TypeStruct, Schema: "toonHandle", Optional: true}, // nil for computers and closed slots
+		{Path: "1", Label: "result", Type: TypeStruct, Schema: "s2gsPlayerResult", Optional: true},
+	}},
+	// s2gsMap is the instance header of the map played, followed by a field not understood yet.
+	&Schema{Name: "s2gsMap", KeepUnknown: true, Fields: []Field{
+		{Path: "0", Label: "id", Type: TypeInt},
+		{Path: "1", Label: "version", Type: TypeInt}, // major version << 16 | minor version
+	}},
+	&Schema{Name: "s2gsPlayerResult", KeepUnknown: true, Fields: []Field{
+		{Path: "0", Label: "decision", Type: TypeInt}, // 0: win, 1: loss, 2: tie, 3: undecided
+	}},
+	// s2gsStat is an element of the field 0 of the instances of the game summary following the first three.
+	&Schema{Name: "s2gsStat", KeepUnknown: true, Fields: []Field{
+		// ids of scores are below 1000000, those of build orders from 2000000
+		{Path: "0", Label: "stat", Type: TypeStruct, Schema: "attributeLink"},
+		// points of each player, a single one for scores
+		{Path: "1", Label: "values", Type: TypeArray, Elem: &Field{Type: TypeArray, Elem: &Field{Type: TypeStruct, Schema: "s2gsStatPoint"}}},
+	}},
+	&Schema{Name: "s2gsStatPoint", KeepUnknown: true, Fields: []Field{
+		{Path: "0", Label: "value", Type: TypeInt},
+		{Path: "2", Label: "time", Type: TypeInt},
+	}},
+)
+
+// knownSpecialTags are the special tags of s2mh.
+var knownSpecialTags = []string{
+	"BLIZ", "TRIL", "FEAT", "PRGN",
+	"HotS", "LotV", "WoL", "WoLX",
+	"HoSX", "LoVX", "HerX", "Desc",
+	"Glue", "Blnc", "PREM",
+}
+
+// newSchemas returns the registry of schemas.
+func newSchemas(schemas ...*Schema) map[string]*Schema {
+	m := make(map[string]*Schema, len(schemas))
+	for _, s := range schemas {
+		m[s.Name] = s
+	}
+	return m
+}
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func int64Ptr(v int64) *int64 {
+	return &v
+}
+
+// ----------------------------------------------------------
+
+// Labeler labels unlabeled structs by Schemas, see ReadS2MH, ReadS2MI and ReadS2GS.
+type Labeler struct {
+	// Lenient tells to label structs of unknown versions and of unexpected lengths with every known field
+	// instead of failing. Fields of paths not known by the schema are kept under "_unknown" keyed by path.
+	// A warning is returned for each of these. Schemas with KeepUnknown keep these fields without warning in any mode.
+	Lenient bool
+
+	// Strict tells to fail on the first warning instead of returning the warnings, even in lenient mode.
+	Strict bool
+}
+
+// Warning describes an unexpected but decodable value found by labeling.
+type Warning struct {
+	Path    string `json:"path"` // JSON pointer of the labeled value, e.g. "/variants/3/lockedAttributes"
+	Message string `json:"message"`
+}
+
+// String returns the path and the message of the Warning.
+func (w Warning) String() string {
+	return w.Path + ": " + w.Message
+}
+
+// LabelError describes where and why labeling an unlabeled struct failed.
+type LabelError struct {
+	Path     string // JSON pointer of the labeled value, e.g. "/variants/3/lockedAttributes/0/lockedScopes"
+	Expected string // Kind of the unlabeled value expected by the schema, e.g. "bitArray", empty if any
+	Actual   string // Kind of the unlabeled value found, e.g. "nil", empty if unknown
+	Err      error  // Cause of the failure
+}
+
+// Error implements the error interface.
+func (e *LabelError) Error() string {
+	sb := strings.Builder{}
+	sb.WriteString("labeling error")
+	if e.Path != "" {
+		fmt.Fprintf(&sb, " at %s", e.Path)
+	}
+	if e.Expected != "" && e.Actual != "" && e.Expected != e.Actual {
+		fmt.Fprintf(&sb, " (expected %s, got %s)", e.Expected, e.Actual)
+	}
+	fmt.Fprintf(&sb, ": %v", e.Err)
+	return sb.String()
+}
+
+// Unwrap returns the cause of the failure.
+func (e *LabelError) Unwrap() error {
+	return e.Err
+}
+
+var errUnexpectedKind = errors.New("unexpected kind")
+
+// labeler holds the state of a labeling by Labeler.
+type labeler struct {
+	*Labeler
+	schemas  map[string]*Schema // Registry of the schemas labeled by, Schemas if nil
+	path     []string           // Labels and array indices leading to the value being labeled, outermost first
+	warnings []Warning
+}
+
+// pointerEscaper escapes the reference tokens of JSON pointers.
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// pointer returns the JSON pointer of the current path.
+func (l *labeler) pointer() string {
+	sb := strings.Builder{}
+	for _, elem := range l.path {
+		sb.WriteString("/")
+		sb.WriteString(pointerEscaper.Replace(elem))
+	}
+	return sb.String()
+}
+
+// warn records a warning at the current path, in strict mode it is returned as a *LabelError instead.
+func (l *labeler) warn(format string, a ...interface{}) error {
+	w := Warning{Path: l.pointer(), Message: fmt.Sprintf(format, a...)}
+	if l.Strict {
+		return &LabelError{Path: w.Path, Err: errors.New(w.Message)}
+	}
+	l.warnings = append(l.warnings, w)
+	return nil
+}
+
+// warnField records a warning about the value of f at the current path, see warn.
+// Fields without label are referred to by their paths, the current path being the one of their struct.
+func (l *labeler) warnField(f *Field, format string, a ...interface{}) error {
+	if f.Label == "" && f.Path != "" {
+		format = "[" + f.Path + "] " + format
+	}
+	return l.warn(format, a...)
+}
+
+// fail returns a *LabelError at the current path about v expected to be of kind expected.
+func (l *labeler) fail(expected string, v interface{}, err error) error {
+	return &LabelError{Path: l.pointer(), Expected: expected, Actual: kindOf(v), Err: err}
+}
+
+// failField returns a *LabelError about the value v of f at the current path, see fail.
+// Fields without label are referred to by their paths, the current path being the one of their struct.
+func (l *labeler) failField(f *Field, v interface{}, err error) error {
+	if f.Label == "" && f.Path != "" {
+		err = fmt.Errorf("[%s] %w", f.Path, err)
+	}
+	return l.fail(f.Type.kind(), v, err)
+}
+
+// push appends elem to the current path.
+func (l *labeler) push(elem string) {
+	l.path = append(l.path, elem)
+}
+
+// pop removes the last element of the current path.
+func (l *labeler) pop() {
+	l.path = l.path[:len(l.path)-1]
+}
+
+// assertStructLen asserts that s, the value of f or the struct being labeled if f is nil, has n fields.
+// In lenient mode only a warning is recorded if it has more.
+func (l *labeler) assertStructLen(f *Field, s s2prot.Struct, n int) error {
+	if len(s) == n {
+		return nil
+	}
+	if f == nil {
+		f = &Field{Type: TypeStruct}
+	}
+	if l.Lenient && len(s) > n {
+		return l.warnField(f, "%v", makeErrStructLen(s))
+	}
+	return l.failField(f, s, makeErrStructLen(s))
+}
+
+// labelStruct labels unlabeled by the schema named name. The fields not understood yet, and the fields unknown
+// to the schema if l is Lenient or the schema keeps them, are kept under "_unknown" keyed by path.
+func (l *labeler) labelStruct(name string, unlabeled s2prot.Struct) (s2prot.Struct, error) {
+	schemas := l.schemas
+	if schemas == nil {
+		schemas = Schemas
+	}
+	schema, ok := schemas[name]
+	if !ok {
+		return nil, l.fail("struct", unlabeled, fmt.Errorf("unknown schema: %s", name))
+	}
+	if schema.Len > 0 { // assert
+		if err := l.assertStructLen(nil, unlabeled, schema.Len); err != nil {
+			return nil, err
+		}
+	}
+	versioned, ver := schema.versioned(), 0
+	if versioned {
+		var errVer error
+		if ver, errVer = verOf(unlabeled); errVer != nil {
+			return nil, l.fail("struct", unlabeled, fmt.Errorf("%s: %w", name, errVer))
+		}
+		if len(schema.Versions) > 0 && !isIntIn(ver, schema.Versions) { // assert
+			if !l.Lenient {
+				return nil, l.fail("struct", unlabeled, fmt.Errorf("%s: %w", name, makeErrVer(ver)))
+			}
+			if err := l.warn("unknown version of %s: %d", name, ver); err != nil {
+				return nil, err
+			}
+		}
+	}
+	ret := s2prot.Struct{}
+	unknown := s2prot.Struct{}
+	for i := range schema.Fields {
+		f := &schema.Fields[i]
+		if versioned && !f.inVersion(ver) {
+			continue
+		}
+		if f.Unknown {
+			if v := valueAt(unlabeled, f.Path); v != nil {
+				unknown[f.Path] = v
+			}
+			continue
+		}
+		if f.Label != "" {
+			l.push(f.Label)
+		}
+		v, err := l.labelField(f, valueAt(unlabeled, f.Path))
+		if err != nil {
+			return nil, err
+		}
+		if f.Label != "" {
+			l.pop()
+			ret[f.Label] = v
+		}
+	}
+	if l.Lenient || schema.KeepUnknown {
+		fields := schema.unknownFields(unlabeled)
+		if !schema.KeepUnknown {
+			paths := make([]string, 0, len(fields))
+			for path := range fields {
+				paths = append(paths, path)
+			}
+			sort.Slice(paths, func(i, j int) bool { return lessPath(paths[i], paths[j]) })
+			for _, path := range paths {
+				if err := l.warn("unknown field of %s: %s", name, path); err != nil {
+					return nil, err
+				}
+			}
+		}
+		for path, v := range fields {
+			unknown[path] = v
+		}
+	}
+	if len(unknown) > 0 {
+		ret["_unknown"] = unknown
+	}
+	return ret, nil
+}
+
+// unknownFields returns the fields of unlabeled whose paths are not known by the schema keyed by path,
+// nil if there are none. A path is known if it is the path of a field of the schema, whatever the version.
+// The fields within a struct or array whose path only starts the paths of some fields are looked for the same way.
+func (s *Schema) unknownFields(unlabeled s2prot.Struct) s2prot.Struct {
+	unknown := s2prot.Struct{}
+	for tag, v := range unlabeled {
+		s.addUnknownFields(unknown, tag, v)
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	return unknown
+}
+
+// addUnknownFields adds v at path to unknown if its path is not known by the schema, see unknownFields.
+func (s *Schema) addUnknownFields(unknown s2prot.Struct, path string, v interface{}) {
+	prefix := false
+	for i := range s.Fields {
+		p := s.Fields[i].Path
+		if p == path {
+			return
+		}
+		prefix = prefix || strings.HasPrefix(p, path+".")
+	}
+	if !prefix {
+		unknown[path] = v
+		return
+	}
+	switch v := v.(type) {
+	case nil:
+	case s2prot.Struct:
+		for tag, fv := range v {
+			s.addUnknownFields(unknown, path+"."+tag, fv)
+		}
+	case []interface{}:
+		for i, elem := range v {
+			s.addUnknownFields(unknown, path+"."+strconv.Itoa(i), elem)
+		}
+	default:
+		unknown[path] = v
+	}
+}
+
+// lessPath tells if the path a comes before b, their tags and indices being compared as numbers.
+func lessPath(a, b string) bool {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if as[i] != bs[i] {
+			an, _ := strconv.Atoi(as[i])
+			bn, _ := strconv.Atoi(bs[i])
+			return an < bn
+		}
+	}
+	return len(as) < len(bs)
+}
+
+// valueAt returns the value at path of a struct, nil if there is none.
+func valueAt(unlabeled s2prot.Struct, path string) interface{} {
+	var v interface{} = unlabeled
+	for _, elem := range strings.Split(path, ".") {
+		key, err := strconv.ParseInt(elem, 10, 64)
+		if err != nil {
+			return nil
+		}
+		if v, _ = childValue(v, key); v == nil {
+			return nil
+		}
+	}
+	return v
+}
+
+// labelField labels the value v of the field f.
+func (l *labeler) labelField(f *Field, v interface{}) (interface{}, error) {
+	if !f.Type.accepts(v) {
+		return nil, l.failField(f, v, errUnexpectedKind)
+	}
+	switch f.Type {
+	case TypeAny:
+		return v, nil
+	case TypeInt:
+		i, _ := v.(int64)
+		if f.Equals != nil && i != *f.Equals { // assert
+			if err := l.warnField(f, "unexpected value: %v", i); err != nil {
+				return nil, err
+			}
+		}
+		return i, nil
+	case TypeBool:
+		i, _ := v.(int64)
+		return i != 0, nil
+	case TypeStrictBool:
+		i, _ := v.(int64)
+		b, errBool := toBool(int(i))
+		if errBool != nil {
+			if err := l.warnField(f, "%v", errBool); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case TypeString, TypeTrimmedString:
+		s, _ := v.(string)
+		if f.Type == TypeTrimmedString {
+			s = strings.Trim(s, "\x00")
+		}
+		if err := l.assertOneOf(f, s); err != nil {
+			return nil, err
+		}
+		return s, nil
+	case TypeDepotLink:
+		s, _ := v.(string)
+		link, err := readDepotLink([]byte(s))
+		if err != nil {
+			return nil, l.failField(f, v, err)
+		}
+		return link, nil
+	case TypeBitMask16:
+		b, _ := v.(s2prot.BitArr)
+		if len(b.Data) < 2 { // assert
+			return nil, l.failField(f, v, fmt.Errorf("unexpected bit array len: %d", b.Count))
+		}
+		return int64(binary.BigEndian.Uint16(b.Data)), nil
+	case TypeSlots:
+		switch v := v.(type) {
+		case s2prot.BitArr:
+			return slotsOf(v), nil
+		case int64:
+			return slotsOf(s2prot.BitArr{Count: 64, Data: bigEndianBytes(v)}), nil
+		}
+		return []interface{}{}, nil
+	case TypeStruct:
+		s, _ := v.(s2prot.Struct)
+		if s == nil && f.Optional {
+			return s, nil // a nil struct is returned instead of nil
+		}
+		if f.Len != nil { // assert
+			if err := l.assertStructLen(f, s, *f.Len); err != nil {
+				return nil, err
+			}
+		}
+		if f.Schema == "" {
+			return s, nil
+		}
+		return l.labelStruct(f.Schema, s)
+	case TypeStructOrArray:
+		// either a list of structs or a single struct
+		switch v := v.(type) {
+		case []interface{}:
+			return l.labelArray(&Field{Type: TypeStruct, Schema: f.Schema}, v)
+		case s2prot.Struct:
+			return l.labelStruct(f.Schema, v)
+		}
+		return nil, l.failField(f, v, errUnexpectedKind)
+	case TypeArray:
+		a, _ := v.([]interface{})
+		if f.Len != nil && len(a) != *f.Len { // assert
+			if err := l.warnField(f, "%v", makeErrArrayLen(a)); err != nil {
+				return nil, err
+			}
+		}
+		if f.Elem == nil {
+			return a, nil
+		}
+		return l.labelArray(f.Elem, a)
+	case TypeSections:
+		s, _ := v.(s2prot.Struct)
+		return l.labelSections(f.Schema, s)
+	case TypeTags:
+		switch v := v.(type) {
+		case nil:
+			return []interface{}{}, nil // an empty list is returned instead of nil
+		case string:
+			if err := l.assertOneOf(f, v); err != nil {
+				return nil, err
+			}
+			return []interface{}{v}, nil
+		case []interface{}:
+			return l.labelArray(&Field{Type: TypeTrimmedString, OneOf: f.OneOf}, v)
+		}
+	}
+	return nil, l.failField(f, v, fmt.Errorf("unknown field type: %s", f.Type))
+}
+
+// slotsOf returns the indices of the set bits of b, bit i being for slot i when b is read as a big endian integer.
+// This is the order of lockedScopes, labeled by TypeBitMask16 with binary.BigEndian, whose lowest bit is the first slot.
+func slotsOf(b s2prot.BitArr) []interface{} {
+	n := len(b.Data) * 8
+	if b.Count < n {
+		n = b.Count
+	}
+	slots := []interface{}{}
+	for i := 0; i < n; i++ {
+		if b.Data[len(b.Data)-1-i/8]&(1<<uint(i%8)) != 0 {
+			slots = append(slots, int64(i))
+		}
+	}
+	return slots
+}
+
+// bigEndianBytes returns the big endian representation of v.
+func bigEndianBytes(v int64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(v))
+	return b
+}
+
+// labelArray labels the elements of arr by elem.
+func (l *labeler) labelArray(elem *Field, arr []interface{}) ([]interface{}, error) {
+	ret := make([]interface{}, len(arr))
+	for i, v := range arr {
+		l.push(strconv.Itoa(i))
+		labeled, err := l.labelField(elem, v)
+		if err != nil {
+			return nil, err
+		}
+		l.pop()
+		ret[i] = labeled
+	}
+	return ret, nil
+}
+
+// labelSections labels unlabeled by the schema named name into headers and items,
+// and returns the headers each holding its items instead of the offset of its first item.
+func (l *labeler) labelSections(name string, unlabeled s2prot.Struct) ([]interface{}, error) {
+	labeled, err := l.labelStruct(name, unlabeled)
+	if err != nil {
+		return nil, err
+	}
+	sectHeaders, sectItems := labeled.Array("headers"), labeled.Array("items")
+	for i, prevOffset := len(sectHeaders)-1, int64(len(sectItems)); i >= 0; i-- { // reversed
+		sectHeader := sectHeaders[i].(s2prot.Struct) // labeled by the schema
+		startOffset := sectHeader.Int("startOffset")
+		if startOffset < 0 || startOffset > prevOffset { // assert
+			return nil, l.fail("struct", unlabeled, fmt.Errorf("unexpected start offset of section %d: %d", i, startOffset))
+		}
+		sectHeader["items"] = sectItems[startOffset:prevOffset]
+		prevOffset = startOffset
+		delete(sectHeader, "startOffset")
+	}
+	return sectHeaders, nil
+}
+
+// assertOneOf records a warning if s is not one of the values allowed by the field, see warn.
+func (l *labeler) assertOneOf(f *Field, s string) error {
+	if len(f.OneOf) > 0 && !isStrIn(s, f.OneOf) { // assert
+		return l.warnField(f, "unexpected value: %s", s)
+	}
+	return nil
+}
+
+// ----------------------------------------------------------
+
+// S2MHFieldNames are the names of the fields of the labeled s2mh returned by ReadS2MH, built from Schemas.
+var S2MHFieldNames = schemaFieldNames("s2mh", "0")
+
+// S2MIFieldNames are the names of the fields of the labeled s2mi returned by ReadS2MI, built from Schemas.
+var S2MIFieldNames = schemaFieldNames("s2mi", "0")
+
+// schemaFieldNames returns the names of the fields of the schema named name, their paths prefixed by prefix.
+func schemaFieldNames(name, prefix string) FieldNames {
+	names := FieldNames{}
+	addSchemaFieldNames(names, name, prefix)
+	return names
+}
+
+// addSchemaFieldNames adds the names of the fields of the schema named name to names, their paths prefixed by prefix.
+func addSchemaFieldNames(names FieldNames, name, prefix string) {
+	schema := Schemas[name]
+	if schema == nil {
+		return
+	}
+	for i := range schema.Fields {
+		f := &schema.Fields[i]
+		path := prefix + "." + schema.pattern(f.Path)
+		if f.Label != "" {
+			names[path] = f.Label
+		}
+		addFieldNames(names, f, path)
+	}
+}
+
+// addFieldNames adds the names of the fields within the value of f to names, their paths prefixed by prefix.
+func addFieldNames(names FieldNames, f *Field, prefix string) {
+	switch f.Type {
+	case TypeStruct, TypeSections:
+		addSchemaFieldNames(names, f.Schema, prefix)
+	case TypeStructOrArray:
+		addSchemaFieldNames(names, f.Schema, prefix)
+		addSchemaFieldNames(names, f.Schema, prefix+".*")
+	case TypeArray:
+		if f.Elem != nil {
+			addFieldNames(names, f.Elem, prefix+".*")
+		}
+	}
+}
+
+// pattern returns path with "*" in place of the indices of the array fields of the schema.
+func (s *Schema) pattern(path string) string {
+	elems := strings.Split(path, ".")
+	for i := 1; i < len(elems); i++ {
+		prefix := strings.Join(elems[:i], ".")
+		for j := range s.Fields {
+			if s.Fields[j].Path == prefix && s.Fields[j].Type == TypeArray {
+				elems[i] = "*"
+			}
+		}
+	}
+	return strings.Join(elems, ".")
+}
@@ -0,0 +1,219 @@
+package s2mdec
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/icza/s2prot"
+)
+
+func TestSchemas(t *testing.T) {
+	// every referenced schema is registered
+	var check func(f *Field)
+	check = func(f *Field) {
+		if f.Schema != "" && Schemas[f.Schema] == nil {
+			t.Error("Unexpected schema:", f.Schema)
+		}
+		if f.Elem != nil {
+			check(f.Elem)
+		}
+	}
+	for name, s := range Schemas {
+		if s.Name != name {
+			t.Error("Unexpected name:", s.Name)
+		}
+		for i := range s.Fields {
+			check(&s.Fields[i])
+		}
+	}
+	// exported schemas are read back
+	data, err := json.Marshal(Schemas)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	var schemas map[string]*Schema
+	if err := json.Unmarshal(data, &schemas); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if !reflect.DeepEqual(schemas, Schemas) {
+		t.Error("Unexpected value!")
+	}
+}
+
+func TestLabelStruct(t *testing.T) {
+	schemas := newSchemas(
+		&Schema{Name: "test", Versions: []int{2, 3}, Fields: []Field{
+			{Path: "0", Label: "header", Type: TypeStruct, Schema: "instanceHeader"},
+			{Path: "1.0", Label: "first", Type: TypeTrimmedString},
+			{Path: "2", Label: "flag", Type: TypeStrictBool},
+			{Path: "3", Label: "extra", Type: TypeInt, MinVersion: 3},
+		}},
+		Schemas["instanceHeader"],
+	)
+
+	unlabeled := s2prot.Struct{
+		"0": s2prot.Struct{"0": int64(7), "1": int64(65537)},
+		"1": []interface{}{"ab\x00"},
+		"2": int64(1),
+	}
+	l := &labeler{Labeler: &Labeler{}, schemas: schemas}
+	labeled, err := l.labelStruct("test", unlabeled)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	expected := s2prot.Struct{
+		"header": s2prot.Struct{"id": int64(7), "version": int64(65537)},
+		"first":  "ab",
+		"flag":   true,
+	}
+	if !reflect.DeepEqual(labeled, expected) {
+		t.Error("Unexpected value:", labeled)
+	}
+
+	unlabeled["3"] = int64(5)
+	if labeled, _ := l.labelStruct("test", unlabeled); labeled.Int("extra") != 5 {
+		t.Error("Unexpected value:", labeled)
+	}
+
+	unlabeled["4"] = int64(0)
+	if _, err := l.labelStruct("test", unlabeled); err == nil {
+		t.Error("Expected error for unknown version!")
+	}
+
+	l = &labeler{Labeler: &Labeler{Lenient: true}, schemas: schemas}
+	if labeled, err = l.labelStruct("test", unlabeled); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if labeled.Int("extra") != 5 || !reflect.DeepEqual(labeled["_unknown"], s2prot.Struct{"4": int64(0)}) {
+		t.Error("Unexpected value:", labeled)
+	}
+	if !reflect.DeepEqual(l.warnings, []Warning{{"", "unknown version of test: 4"}, {"", "unknown field of test: 4"}}) {
+		t.Error("Unexpected warnings:", l.warnings)
+	}
+
+	// Unknown fields within partly known fields are kept by path
+	unlabeled["1"] = []interface{}{"ab\x00", "cd"}
+	l = &labeler{Labeler: &Labeler{Lenient: true}, schemas: schemas}
+	if labeled, err = l.labelStruct("test", unlabeled); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if !reflect.DeepEqual(labeled["_unknown"], s2prot.Struct{"1.1": "cd", "4": int64(0)}) {
+		t.Error("Unexpected value:", labeled)
+	}
+	if w := l.warnings; len(w) != 3 || w[1].Message != "unknown field of test: 1.1" {
+		t.Error("Unexpected warnings:", w)
+	}
+}
+
+func TestReadS2MHLenient(t *testing.T) {
+	unlabeled := testS2MH()
+	s2mh := unlabeled.Structv("0")
+	s2mh["25"] = "new"
+	s2mh["13"].([]interface{})[0].(s2prot.Struct)["16"] = int64(1)
+	if _, err := ReadS2MH(unlabeled); err == nil {
+		t.Error("Expected error for unknown version!")
+	}
+	labeled, warnings, err := (&Labeler{Lenient: true}).ReadS2MH(unlabeled)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if labeled.Stringv("filename") != "ColdVoyage.SC2Map" || labeled.Stringv("_unknown", "25") != "new" {
+		t.Error("Unexpected value!")
+	}
+	if variant := labeled["variants"].([]interface{})[0].(s2prot.Struct); variant.Int("maxTeamSize") != 5 {
+		t.Error("Unexpected value!")
+	}
+	expected := []Warning{
+		{"", "unknown version of s2mh: 25"},
+		{"/variants/0", "unknown version of variantInfo: 16"},
+		{"/variants/0", "unknown field of variantInfo: 16"},
+		{"", "unknown field of s2mh: 25"},
+	}
+	if !reflect.DeepEqual(warnings, expected) {
+		t.Error("Unexpected warnings:", warnings)
+	}
+}
+
+func TestReadS2MHWarnings(t *testing.T) {
+	unlabeled := testS2MH()
+	s2mh := unlabeled.Structv("0")
+	s2mh["15"] = int64(3)
+	s2mh["18"] = []interface{}{"BLIZ", "XXXX"}
+	s2mh.Structv("4")["5"] = int64(21)
+	s2mh.Structv("19")["0"] = []interface{}{"s2mv"}
+	labeled, warnings, err := (&Labeler{}).ReadS2MH(unlabeled)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if labeled["addDefaultPermissions"] != true || !reflect.DeepEqual(labeled["specialTags"], []interface{}{"BLIZ", "XXXX"}) {
+		t.Error("Unexpected value!")
+	}
+	expected := []Warning{
+		{"/workingSet", "[5] unexpected value: 21"},
+		{"/addDefaultPermissions", "unexpected value casted to bool: 0x3"},
+		{"/specialTags/1", "unexpected value: XXXX"},
+		{"/arcadeInfo", "[0] unexpected array len: 1"},
+	}
+	if !reflect.DeepEqual(warnings, expected) {
+		t.Error("Unexpected warnings:", warnings)
+	}
+	if _, err := ReadS2MH(unlabeled); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+	if _, _, err := (&Labeler{Strict: true}).ReadS2MH(unlabeled); err == nil || !strings.Contains(err.Error(), "/workingSet: [5] unexpected value: 21") {
+		t.Error("Unexpected error:", err)
+	}
+}
+
+func TestLabelError(t *testing.T) {
+	unlabeled := testS2MH()
+	s2mh := unlabeled.Structv("0")
+	variant := s2mh["13"].([]interface{})[0].(s2prot.Struct)
+	variant["7"].([]interface{})[0].(s2prot.Struct)["1"] = nil
+	_, err := ReadS2MH(unlabeled)
+	var errLabel *LabelError
+	if !errors.As(err, &errLabel) {
+		t.Fatal("Unexpected error:", err)
+	}
+	if errLabel.Path != "/variants/0/lockedAttributes/0/lockedScopes" || errLabel.Expected != "bitArray" || errLabel.Actual != "nil" {
+		t.Error("Unexpected error:", errLabel)
+	}
+
+	unlabeled = testS2MH()
+	unlabeled.Structv("0")["1"] = int64(1)
+	_, err = ReadS2MH(unlabeled)
+	if !errors.As(err, &errLabel) || !errors.Is(err, errUnexpectedKind) {
+		t.Fatal("Unexpected error:", err)
+	}
+	if err.Error() != "labeling error at /filename (expected blob, got int): unexpected kind" {
+		t.Error("Unexpected error:", err)
+	}
+}
+
+func TestS2MHApplyS2ML(t *testing.T) {
+	unlabeled := testS2MH()
+	delete(unlabeled.Structv("0"), "19") // arcadeInfo
+	labeled, err := ReadS2MH(unlabeled)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	translated, err := S2MHApplyS2ML(labeled, MapLocale{"1": "Cold Voyage", "8": "Category", "7": "Tileset"}, nil)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	variant := translated["variants"].([]interface{})[0].(s2prot.Struct)
+	if translated.Stringv("workingSet", "name") != "Cold Voyage" || translated["tileset"] != "Tileset" || variant["categoryName"] != "Category" {
+		t.Error("Unexpected value!")
+	}
+	if translated.Value("workingSet", "description") != "" || translated.Structv("arcadeInfo") != nil {
+		t.Error("Unexpected value!")
+	}
+
+	labeled["variants"] = []interface{}{"variant"}
+	if _, err := S2MHApplyS2ML(labeled, MapLocale{}, nil); err == nil {
+		t.Error("Expected error for unexpected type!")
+	}
+}
@@ -0,0 +1,170 @@
+// Implementation of the annotated dump of the versioned format.
+
+package s2mdec
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// FieldNames maps paths of unlabeled instances to the names of the labeled fields, see Trace.
+// Paths are dot separated struct field tags and array indices like those of CompilePaths,
+// "*" matching any array index, e.g. "0.13.*.1" is "categoryName" of every variant of the s2mh.
+type FieldNames map[string]string
+
+// Max number of raw bytes and characters of blobs written by Trace per node.
+const (
+	traceMaxRaw  = 8
+	traceMaxBlob = 64
+)
+
+// Trace reads the next instance and writes an annotated dump of it to w, a line per node.
+// A line holds the bit offset and the byte range of the node, its raw bytes as hex, its DataType,
+// struct field tag or array index, and the decoded value. Struct field tags found in names
+// are followed by their labeled names, names may be nil.
+//
+// Raw bytes are taken from the buffer of the decoder, they are not available for the nodes whose bytes
+// a decoder created by NewVersionedDecReader has already discarded.
+func (d *VersionedDec) Trace(w io.Writer, names FieldNames) error {
+	t := &tracer{dec: d, w: w, names: names, last: d.bitOffset()}
+	if _, err := fmt.Fprintf(w, "%10s  %-15s  %-*s  %s\n", "bit", "bytes", traceMaxRaw*3, "raw", "node"); err != nil {
+		return err
+	}
+	return d.Walk(t)
+}
+
+// tracer is the Visitor writing the lines of Trace.
+type tracer struct {
+	dec    *VersionedDec
+	w      io.Writer
+	names  FieldNames
+	last   int64         // Bit offset at which the previous node ended
+	frames []*traceFrame // Arrays and structs being traced, innermost last
+}
+
+// traceFrame is an array or struct being traced.
+type traceFrame struct {
+	depth   int   // Nesting depth of the array or struct
+	isArray bool  // Tells if the frame is an array
+	key     int64 // Tag of the current field, or index of the current element
+}
+
+// line writes the line of the node ending at the current position.
+func (t *tracer) line(format string, a ...interface{}) error {
+	end := t.dec.bitOffset()
+	start := t.last
+	t.last = end
+
+	desc := fmt.Sprintf(format, a...)
+	if n := len(t.frames); n > 0 {
+		if f := t.frames[n-1]; f.isArray && t.dec.depth == f.depth+1 {
+			f.key++ // First node of the next element
+			desc = "[" + strconv.FormatInt(f.key, 10) + "] " + desc
+		}
+	}
+
+	raw := "??"
+	if b, ok := t.dec.rawBytes(start, end); ok {
+		raw = rawHex(b)
+	}
+
+	_, err := fmt.Fprintf(t.w, "%10d  %6d - %-6d  %-*s  %s%s\n", start, start/8, (end+7)/8, traceMaxRaw*3, raw,
+		strings.Repeat("  ", t.dec.depth-1), desc)
+	return err
+}
+
+// rawHex returns b as space separated hex bytes, truncated to traceMaxRaw bytes.
+func rawHex(b []byte) string {
+	if len(b) > traceMaxRaw {
+		return fmt.Sprintf("% x ..", b[:traceMaxRaw-1])
+	}
+	return fmt.Sprintf("% x", b)
+}
+
+// path returns the path of the current node, and its pattern with "*" in place of array indices.
+func (t *tracer) path() (path, pattern string) {
+	p := make([]string, len(t.frames))
+	q := make([]string, len(t.frames))
+	for i, f := range t.frames {
+		p[i] = strconv.FormatInt(f.key, 10)
+		q[i] = p[i]
+		if f.isArray {
+			q[i] = "*"
+		}
+	}
+	return strings.Join(p, "."), strings.Join(q, ".")
+}
+
+func (t *tracer) BeginStruct(nFields int) error {
+	if err := t.line("struct(%d)", nFields); err != nil {
+		return err
+	}
+	t.frames = append(t.frames, &traceFrame{depth: t.dec.depth})
+	return nil
+}
+
+func (t *tracer) Field(tag int64) error {
+	t.frames[len(t.frames)-1].key = tag
+	path, pattern := t.path()
+	if name, ok := t.names[pattern]; ok && name != "" {
+		return t.line(".%d %s (%s)", tag, name, path)
+	}
+	return t.line(".%d (%s)", tag, path)
+}
+
+func (t *tracer) EndStruct() error {
+	t.frames = t.frames[:len(t.frames)-1]
+	return nil
+}
+
+func (t *tracer) BeginArray(length int) error {
+	if err := t.line("array(%d)", length); err != nil {
+		return err
+	}
+	t.frames = append(t.frames, &traceFrame{depth: t.dec.depth, isArray: true, key: -1})
+	return nil
+}
+
+func (t *tracer) EndArray() error {
+	t.frames = t.frames[:len(t.frames)-1]
+	return nil
+}
+
+func (t *tracer) Choice(tag int64) error {
+	return t.line("choice %d", tag)
+}
+
+func (t *tracer) Optional(present bool) error {
+	if present {
+		return t.line("optional present")
+	}
+	return t.line("optional absent")
+}
+
+func (t *tracer) Int(dataType DataType, v int64) error {
+	return t.line("%v %d", dataType, v)
+}
+
+func (t *tracer) Blob(dataType DataType, b []byte) error {
+	s := string(b)
+	if len(s) > traceMaxBlob {
+		return t.line("%v(%d) %q..", dataType, len(b), s[:traceMaxBlob])
+	}
+	return t.line("%v(%d) %q", dataType, len(b), s)
+}
+
+func (t *tracer) BitArray(bits int, data []byte) error {
+	return t.line("bitArray(%d) 0x%x", bits, data)
+}
+
+// rawBytes returns the bytes of the buffer holding the bits from start to end (exclusive),
+// or false if they are not in the buffer.
+func (b *BitPackedBuff) rawBytes(start, end int64) ([]byte, bool) {
+	from, to := start/8-b.base, (end+7)/8-b.base
+	if from < 0 || to > int64(len(b.contents)) || from > to {
+		return nil, false
+	}
+	return b.contents[from:to], true
+}
@@ -0,0 +1,34 @@
+package s2mdec
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTrace(t *testing.T) {
+	sb := &strings.Builder{}
+	if err := NewVersionedDec(testStructData).Trace(sb, nil); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	lines := strings.Split(strings.TrimSpace(sb.String()), "\n")
+	if len(lines) != 6 {
+		t.Fatal("Unexpected lines:", lines)
+	}
+	if f := strings.Fields(lines[5]); strings.Join(f, " ") != `48 6 - 11 02 06 61 62 63 blob(3) "abc"` {
+		t.Error("Unexpected line:", lines[5])
+	}
+
+	data, err := Marshal(testS2MH())
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	sb.Reset()
+	if err := NewVersionedDec(data).Trace(sb, S2MHFieldNames); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	for _, s := range []string{".13 variants (0.13)", "[0] struct(16)", ".1 categoryName (0.13.0.1)", ".2 index (0.13.0.15.1.2)", ".1 filename (0.1)"} {
+		if !strings.Contains(sb.String(), s) {
+			t.Error("Missing from trace:", s)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+// Conversion of labeled structs into the strongly typed models.
+
+package s2mdec
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/icza/s2prot"
+)
+
+var typeTime = reflect.TypeOf(time.Time{})
+
+// labeledUnmarshaler is implemented by the types of the typed models which are not stored field by field.
+type labeledUnmarshaler interface {
+	unmarshalLabeled(v interface{}) error
+}
+
+// fromLabeled stores the labeled value v in the value pointed to by ptr, see storeLabeled.
+func fromLabeled(v interface{}, ptr interface{}) error {
+	return storeLabeled(v, reflect.ValueOf(ptr).Elem(), "")
+}
+
+// storeLabeled stores the labeled value v in the settable rv, path being the JSON pointer of v.
+//
+// Struct fields are matched by the name of their json tag, which is the label of the value, fields missing from
+// the labeled struct being left zero. Labeled structs go into structs, arrays into slices, integers, strings and
+// bools into their Go kind, timestamps into time.Time, see unixTime, and any value into interface{}.
+// nil values store the zero value.
+func storeLabeled(v interface{}, rv reflect.Value, path string) error {
+	typeError := func(err error) error {
+		err = fmt.Errorf("storing %s into %v: %w", kindOf(v), rv.Type(), err)
+		if path != "" {
+			err = fmt.Errorf("%s: %w", path, err)
+		}
+		return err
+	}
+
+	if rv.CanAddr() {
+		if u, ok := rv.Addr().Interface().(labeledUnmarshaler); ok {
+			if err := u.unmarshalLabeled(v); err != nil {
+				return typeError(err)
+			}
+			return nil
+		}
+	}
+	if isNilLabeled(v) {
+		rv.Set(reflect.Zero(rv.Type()))
+		return nil
+	}
+
+	switch rv.Type() {
+	case typeInterface:
+		rv.Set(reflect.ValueOf(v))
+		return nil
+	case typeTime:
+		sec, ok := v.(int64)
+		if !ok {
+			return typeError(errTypeMismatch)
+		}
+		rv.Set(reflect.ValueOf(unixTime(sec)))
+		return nil
+	}
+
+	switch rv.Kind() {
+	case reflect.Ptr:
+		p := reflect.New(rv.Type().Elem())
+		if err := storeLabeled(v, p.Elem(), path); err != nil {
+			return err
+		}
+		rv.Set(p)
+	case reflect.Bool:
+		b, ok := v.(bool)
+		if !ok {
+			return typeError(errTypeMismatch)
+		}
+		rv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok := v.(int64)
+		if !ok {
+			return typeError(errTypeMismatch)
+		}
+		if rv.OverflowInt(i) {
+			return typeError(errOutOfRange)
+		}
+		rv.SetInt(i)
+	case reflect.String:
+		s, ok := v.(string)
+		if !ok {
+			return typeError(errTypeMismatch)
+		}
+		rv.SetString(s)
+	case reflect.Slice:
+		a, ok := v.([]interface{})
+		if !ok {
+			return typeError(errTypeMismatch)
+		}
+		s := reflect.MakeSlice(rv.Type(), len(a), len(a))
+		for i, elem := range a {
+			if err := storeLabeled(elem, s.Index(i), path+"/"+strconv.Itoa(i)); err != nil {
+				return err
+			}
+		}
+		rv.Set(s)
+	case reflect.Map:
+		s, ok := v.(s2prot.Struct)
+		if !ok || rv.Type().Key().Kind() != reflect.String {
+			return typeError(errTypeMismatch)
+		}
+		m := reflect.MakeMapWithSize(rv.Type(), len(s))
+		for key, elem := range s {
+			ev := reflect.New(rv.Type().Elem()).Elem()
+			if err := storeLabeled(elem, ev, path+"/"+pointerEscaper.Replace(key)); err != nil {
+				return err
+			}
+			m.SetMapIndex(reflect.ValueOf(key).Convert(rv.Type().Key()), ev)
+		}
+		rv.Set(m)
+	case reflect.Struct:
+		s, ok := v.(s2prot.Struct)
+		if !ok {
+			return typeError(errTypeMismatch)
+		}
+		t := rv.Type()
+		for i := 0; i < t.NumField(); i++ {
+			label, ok := labelOf(t.Field(i))
+			if !ok {
+				continue
+			}
+			if fv, ok := s[label]; ok {
+				if err := storeLabeled(fv, rv.Field(i), path+"/"+pointerEscaper.Replace(label)); err != nil {
+					return err
+				}
+			}
+		}
+	default:
+		return typeError(fmt.Errorf("unsupported type"))
+	}
+	return nil
+}
+
+// labelOf returns the name of the json tag of an exported struct field.
+func labelOf(sf reflect.StructField) (string, bool) {
+	if sf.PkgPath != "" { // unexported
+		return "", false
+	}
+	name := strings.Split(sf.Tag.Get("json"), ",")[0]
+	if name == "" || name == "-" {
+		return "", false
+	}
+	return name, true
+}
+
+// isNilLabeled tells if the labeled value v is nil, such as an absent optional struct.
+func isNilLabeled(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case s2prot.Struct:
+		return v == nil
+	case []interface{}:
+		return v == nil
+	}
+	return false
+}
@@ -0,0 +1,283 @@
+// Implementation of decoding the versioned format into tagged Go values.
+
+package s2mdec
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/icza/s2prot"
+)
+
+// Unmarshaler is implemented by types that decode themselves from a Value.
+type Unmarshaler interface {
+	UnmarshalS2M(v *Value) error
+}
+
+// UnmarshalError describes why a Value could not be stored in a Go value.
+type UnmarshalError struct {
+	Path     []string     // Struct field tags and array indices leading to the instance, outermost first
+	DataType DataType     // DataType of the instance on the wire, negative if the instance is missing
+	Type     reflect.Type // Go type the instance was to be stored in
+	Err      error        // Cause of the failure
+}
+
+// Error implements the error interface.
+func (e *UnmarshalError) Error() string {
+	sb := strings.Builder{}
+	sb.WriteString("unmarshal error")
+	if len(e.Path) > 0 {
+		fmt.Fprintf(&sb, " in %s", strings.Join(e.Path, "."))
+	}
+	if e.DataType >= 0 {
+		fmt.Fprintf(&sb, " storing %v into %v", e.DataType, e.Type)
+	} else {
+		fmt.Fprintf(&sb, " storing into %v", e.Type)
+	}
+	fmt.Fprintf(&sb, ": %v", e.Err)
+	return sb.String()
+}
+
+// Unwrap returns the cause of the failure.
+func (e *UnmarshalError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	errTypeMismatch = errors.New("type mismatch")
+	errMissingField = errors.New("missing field")
+	errOutOfRange   = errors.New("value out of range")
+)
+
+var (
+	typeValue     = reflect.TypeOf(Value{})
+	typeBitArr    = reflect.TypeOf(s2prot.BitArr{})
+	typeInterface = reflect.TypeOf((*interface{})(nil)).Elem()
+)
+
+// Unmarshal decodes the next instance of data and stores it in the value pointed to by v.
+//
+// Struct fields are matched by the "s2m" key of their tag which holds the field tag on the wire, e.g. `s2m:"4"`.
+// Go fields without the key are left untouched, wire fields without a matching Go field are ignored.
+// A wire field missing from the data is an error unless the "optional" option is given, e.g. `s2m:"9,optional"`.
+//
+// Go types are filled from the following wire types:
+//   - bool and integer types: DataTypeVarInt, DataTypeUint8
+//   - string and []byte: DataTypeBlob, DataTypeUint32, DataTypeUint64
+//   - [4]byte and [8]byte: DataTypeUint32 and DataTypeUint64 respectively, or DataTypeBlob of the same length
+//   - s2prot.BitArr: DataTypeBitArray
+//   - slices: DataTypeArray
+//   - structs: DataTypeStruct
+//   - pointers: DataTypeOptional (nil if absent) or the wire type of the pointed type
+//   - Value and interface{}: any wire type, the latter in the representation returned by ReadStruct
+//
+// A DataTypeChoice is replaced by its chosen instance, and a present DataTypeOptional by its instance
+// unless the Go type is a pointer, Value or implements Unmarshaler.
+func Unmarshal(data []byte, v interface{}) error {
+	val, err := NewVersionedDec(data).DecodeValue()
+	if err != nil {
+		return err
+	}
+	return UnmarshalValue(val, v)
+}
+
+// UnmarshalValue stores val in the value pointed to by v, see Unmarshal.
+func UnmarshalValue(val *Value, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("unmarshal: non-nil pointer expected, got %T", v)
+	}
+	return unmarshalValue(val, rv.Elem())
+}
+
+// unmarshalValue stores val in the settable rv.
+func unmarshalValue(val *Value, rv reflect.Value) error {
+	if val == nil {
+		return &UnmarshalError{DataType: -1, Type: rv.Type(), Err: fmt.Errorf("nil value")}
+	}
+	typeError := func(err error) error {
+		return &UnmarshalError{DataType: val.Type, Type: rv.Type(), Err: err}
+	}
+
+	if rv.CanAddr() {
+		if u, ok := rv.Addr().Interface().(Unmarshaler); ok {
+			if err := u.UnmarshalS2M(val); err != nil {
+				return typeError(err)
+			}
+			return nil
+		}
+	}
+	switch rv.Type() {
+	case typeValue:
+		rv.Set(reflect.ValueOf(*val))
+		return nil
+	case typeInterface:
+		if i := val.Interface(); i != nil {
+			rv.Set(reflect.ValueOf(i))
+		} else {
+			rv.Set(reflect.Zero(rv.Type()))
+		}
+		return nil
+	}
+	if rv.Kind() == reflect.Ptr {
+		if val.Type == DataTypeOptional && val.Elem == nil {
+			rv.Set(reflect.Zero(rv.Type()))
+			return nil
+		}
+		if val.Type == DataTypeOptional && rv.Type().Elem() != typeValue {
+			val = val.Elem
+		}
+		p := reflect.New(rv.Type().Elem())
+		if err := unmarshalValue(val, p.Elem()); err != nil {
+			return err
+		}
+		rv.Set(p)
+		return nil
+	}
+
+	// Unwrap instances which have no Go counterpart
+	switch val.Type {
+	case DataTypeChoice:
+		return unmarshalValue(val.Elem, rv)
+	case DataTypeOptional:
+		if val.Elem == nil {
+			rv.Set(reflect.Zero(rv.Type()))
+			return nil
+		}
+		return unmarshalValue(val.Elem, rv)
+	}
+
+	switch rv.Kind() {
+	case reflect.Bool:
+		if !isIntType(val.Type) {
+			return typeError(errTypeMismatch)
+		}
+		rv.SetBool(val.Int != 0)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if !isIntType(val.Type) {
+			return typeError(errTypeMismatch)
+		}
+		if rv.OverflowInt(val.Int) {
+			return typeError(errOutOfRange)
+		}
+		rv.SetInt(val.Int)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if !isIntType(val.Type) {
+			return typeError(errTypeMismatch)
+		}
+		if val.Int < 0 || rv.OverflowUint(uint64(val.Int)) {
+			return typeError(errOutOfRange)
+		}
+		rv.SetUint(uint64(val.Int))
+	case reflect.String:
+		if !isBytesType(val.Type) {
+			return typeError(errTypeMismatch)
+		}
+		rv.SetString(string(val.Bytes))
+	case reflect.Array:
+		if rv.Type().Elem().Kind() != reflect.Uint8 || !isBytesType(val.Type) {
+			return typeError(errTypeMismatch)
+		}
+		if len(val.Bytes) != rv.Len() {
+			return typeError(fmt.Errorf("%d bytes instead of %d", len(val.Bytes), rv.Len()))
+		}
+		reflect.Copy(rv, reflect.ValueOf(val.Bytes))
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 && isBytesType(val.Type) {
+			rv.SetBytes(append([]byte{}, val.Bytes...))
+			return nil
+		}
+		if val.Type != DataTypeArray {
+			return typeError(errTypeMismatch)
+		}
+		s := reflect.MakeSlice(rv.Type(), len(val.Elems), len(val.Elems))
+		for i, elem := range val.Elems {
+			if err := unmarshalValue(elem, s.Index(i)); err != nil {
+				return prependUnmarshalPath(err, strconv.Itoa(i))
+			}
+		}
+		rv.Set(s)
+	case reflect.Struct:
+		if rv.Type() == typeBitArr {
+			if val.Type != DataTypeBitArray {
+				return typeError(errTypeMismatch)
+			}
+			rv.Set(reflect.ValueOf(s2prot.BitArr{Count: val.Bits, Data: append([]byte{}, val.Bytes...)}))
+			return nil
+		}
+		if val.Type != DataTypeStruct {
+			return typeError(errTypeMismatch)
+		}
+		return unmarshalStruct(val, rv)
+	default:
+		return typeError(fmt.Errorf("unsupported type"))
+	}
+	return nil
+}
+
+// unmarshalStruct stores the fields of val in the tagged fields of the settable struct rv.
+func unmarshalStruct(val *Value, rv reflect.Value) error {
+	t := rv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag, optional, ok := parseFieldTag(sf)
+		if !ok {
+			continue
+		}
+		key := strconv.FormatInt(tag, 10)
+		f := val.Field(tag)
+		if f == nil {
+			if optional {
+				continue
+			}
+			return &UnmarshalError{Path: []string{key}, DataType: -1, Type: sf.Type, Err: errMissingField}
+		}
+		if err := unmarshalValue(f, rv.Field(i)); err != nil {
+			return prependUnmarshalPath(err, key)
+		}
+	}
+	return nil
+}
+
+// parseFieldTag parses the "s2m" key of the tag of an exported struct field.
+func parseFieldTag(sf reflect.StructField) (tag int64, optional bool, ok bool) {
+	if sf.PkgPath != "" { // unexported
+		return 0, false, false
+	}
+	s, ok := sf.Tag.Lookup("s2m")
+	if !ok || s == "-" {
+		return 0, false, false
+	}
+	opts := strings.Split(s, ",")
+	tag, err := strconv.ParseInt(opts[0], 10, 64)
+	if err != nil {
+		return 0, false, false
+	}
+	for _, opt := range opts[1:] {
+		if opt == "optional" {
+			optional = true
+		}
+	}
+	return tag, optional, true
+}
+
+// prependUnmarshalPath prepends a path element to err if it is an *UnmarshalError.
+func prependUnmarshalPath(err error, elem string) error {
+	if e, ok := err.(*UnmarshalError); ok {
+		e.Path = append([]string{elem}, e.Path...)
+	}
+	return err
+}
+
+// isIntType tells if t is decoded into an integer.
+func isIntType(t DataType) bool {
+	return t == DataTypeVarInt || t == DataTypeUint8
+}
+
+// isBytesType tells if t is decoded into bytes.
+func isBytesType(t DataType) bool {
+	return t == DataTypeBlob || t == DataTypeUint32 || t == DataTypeUint64
+}
@@ -0,0 +1,72 @@
+package s2mdec
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestUnmarshal(t *testing.T) {
+	type inner struct {
+		N int `s2m:"0"`
+	}
+	type outer struct {
+		Name   string   `s2m:"1"`
+		Inner  *inner   `s2m:"0"`
+		Absent *int64   `s2m:"7,optional"`
+		Ignore string   // no tag
+		Raw    *Value   `s2m:"1"`
+		Blob   []byte   `s2m:"1"`
+		List   []uint8  `s2m:"8,optional"`
+		Any    []string `s2m:"9,optional"`
+	}
+	// {1: "abc", 0: {0: 5}}
+	data := []byte{0x05, 0x04, 0x02, 0x02, 0x06, 'a', 'b', 'c', 0x00, 0x05, 0x02, 0x00, 0x09, 0x0a}
+
+	var v outer
+	if err := Unmarshal(data, &v); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if v.Name != "abc" || v.Inner == nil || v.Inner.N != 5 || v.Absent != nil || string(v.Blob) != "abc" {
+		t.Error("Unexpected value!")
+	}
+	if v.Raw == nil || v.Raw.Type != DataTypeBlob {
+		t.Error("Unexpected value!")
+	}
+
+	// [optional(nil), optional(-3), bitArray(10, 0xff03), uint64("abcdefgh")]
+	data = []byte{0x00, 0x08, 0x04, 0x00, 0x04, 0x01, 0x09, 0x07, 0x01, 0x14, 0xff, 0x03, 0x08, 'a', 'b', 'c', 'd', 'e', 'f', 'g', 'h'}
+	var arr []interface{}
+	if err := Unmarshal(data, &arr); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if !reflect.DeepEqual(arr, NewVersionedDec(data).ReadStruct()) {
+		t.Error("Unexpected value!")
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	// {0: 5, 1: "abc"}
+	var v1 struct {
+		N string `s2m:"0"`
+	}
+	var unmarshalErr *UnmarshalError
+	if err := Unmarshal(testStructData, &v1); !errors.As(err, &unmarshalErr) || !errors.Is(err, errTypeMismatch) || unmarshalErr.Path[0] != "0" {
+		t.Error("Unexpected error:", err)
+	}
+
+	var v2 struct {
+		N int64 `s2m:"2"`
+	}
+	if err := Unmarshal(testStructData, &v2); !errors.Is(err, errMissingField) {
+		t.Error("Unexpected error:", err)
+	}
+
+	var v3 struct {
+		N int8    `s2m:"0"`
+		S [2]byte `s2m:"1"`
+	}
+	if err := Unmarshal(testStructData, &v3); err == nil {
+		t.Error("Error expected!")
+	}
+}
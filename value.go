@@ -0,0 +1,119 @@
+// Implementation of the lossless representation of decoded instances.
+
+package s2mdec
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+
+	"github.com/icza/s2prot"
+)
+
+// Value is a decoded instance that keeps the exact wire type of every node,
+// as opposed to the representation returned by ReadStruct which merges several types.
+// Only the members relevant to Type are set.
+type Value struct {
+	Type   DataType     // Wire type of the instance
+	Tag    int64        // DataTypeChoice: tag of the chosen type
+	Int    int64        // DataTypeVarInt, DataTypeUint8: the number
+	Bytes  []byte       // DataTypeBlob, DataTypeUint32, DataTypeUint64: the raw bytes; DataTypeBitArray: the packed bits
+	Bits   int          // DataTypeBitArray: number of bits
+	Elem   *Value       // DataTypeChoice: the chosen instance; DataTypeOptional: the instance, nil if absent
+	Elems  []*Value     // DataTypeArray: the elements
+	Fields []ValueField // DataTypeStruct: the fields in wire order
+}
+
+// ValueField is a field of a Value of DataTypeStruct.
+type ValueField struct {
+	Tag   int64  // Field tag as read from the wire
+	Value *Value // Value of the field
+}
+
+// Field returns the value of the field with the given tag, nil if v is not a struct or has no such field.
+func (v *Value) Field(tag int64) *Value {
+	if v == nil || v.Type != DataTypeStruct {
+		return nil
+	}
+	for _, f := range v.Fields {
+		if f.Tag == tag {
+			return f.Value
+		}
+	}
+	return nil
+}
+
+// Interface converts v to the representation returned by ReadStruct.
+func (v *Value) Interface() interface{} {
+	if v == nil {
+		return nil
+	}
+	switch v.Type {
+	case DataTypeArray:
+		arr := make([]interface{}, len(v.Elems))
+		for i, elem := range v.Elems {
+			arr[i] = elem.Interface()
+		}
+		return arr
+	case DataTypeBitArray:
+		return s2prot.BitArr{Count: v.Bits, Data: v.Bytes}
+	case DataTypeBlob, DataTypeUint32, DataTypeUint64:
+		return string(v.Bytes)
+	case DataTypeChoice, DataTypeOptional:
+		return v.Elem.Interface()
+	case DataTypeStruct:
+		s := make(s2prot.Struct, len(v.Fields))
+		for _, f := range v.Fields {
+			s[strconv.FormatInt(f.Tag, 10)] = f.Value.Interface()
+		}
+		return s
+	case DataTypeUint8, DataTypeVarInt:
+		return v.Int
+	}
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+// Every node is written as an object with its type and the members relevant to the type, bytes are hex encoded.
+func (v *Value) MarshalJSON() ([]byte, error) {
+	if v == nil {
+		return []byte("null"), nil
+	}
+	type field struct {
+		Tag   int64  `json:"tag"`
+		Value *Value `json:"value"`
+	}
+	m := map[string]interface{}{"type": v.Type.String()}
+	switch v.Type {
+	case DataTypeArray:
+		m["elems"] = v.Elems
+		if v.Elems == nil {
+			m["elems"] = []*Value{}
+		}
+	case DataTypeBitArray:
+		m["bits"] = v.Bits
+		m["bytes"] = hex.EncodeToString(v.Bytes)
+	case DataTypeBlob, DataTypeUint32, DataTypeUint64:
+		m["bytes"] = hex.EncodeToString(v.Bytes)
+	case DataTypeChoice:
+		m["tag"] = v.Tag
+		m["elem"] = v.Elem
+	case DataTypeOptional:
+		m["elem"] = v.Elem
+	case DataTypeStruct:
+		fields := make([]field, len(v.Fields))
+		for i, f := range v.Fields {
+			fields[i] = field{Tag: f.Tag, Value: f.Value}
+		}
+		m["fields"] = fields
+	case DataTypeUint8, DataTypeVarInt:
+		m["int"] = v.Int
+	}
+	return json.Marshal(m)
+}
+
+// String returns the indented JSON string representation of the Value.
+func (v *Value) String() string {
+	b, _ := json.MarshalIndent(v, "", "  ")
+	return string(b)
+}
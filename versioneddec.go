@@ -3,25 +3,123 @@
 package s2mdec
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"strconv"
-
-	"github.com/icza/s2prot"
+	"strings"
 )
 
 // VersionedDec is a versioned decoder.
 type VersionedDec struct {
 	*BitPackedBuff // Data source: bit-packed buffer
+
+	// OrderedStructs tells to decode DataTypeStruct into OrderedStruct which keeps the wire order of fields,
+	// instead of s2prot.Struct.
+	OrderedStructs bool
+
+	// Limits restricts the resources used to decode an instance, see Limits.
+	Limits Limits
+
+	depth     int   // Nesting depth of the instance being decoded
+	allocated int64 // Bytes accounted for allocation since the top-level instance started
 }
 
-// NewVersionedDec creates a new bit-packed decoder.
+// NewVersionedDec creates a new bit-packed decoder using DefaultLimits.
 func NewVersionedDec(contents []byte) *VersionedDec {
 	return &VersionedDec{
 		BitPackedBuff: &BitPackedBuff{
 			contents:  contents,
 			bigEndian: true, // All versioned decoder uses big endian order
 		},
+		Limits: DefaultLimits,
+	}
+}
+
+// NewVersionedDecReader creates a new bit-packed decoder which pulls bytes on demand from r using a bounded buffer.
+// Instances concatenated in r can be decoded one after another, BytesConsumed tells where the last one ended.
+// The decoder uses DefaultLimits.
+func NewVersionedDecReader(r io.Reader) *VersionedDec {
+	return &VersionedDec{
+		BitPackedBuff: NewBitPackedBuffReader(r, true), // All versioned decoder uses big endian order
+		Limits:        DefaultLimits,
+	}
+}
+
+// Limits restricts the resources used to decode a top-level instance,
+// so that crafted lengths in untrusted input cannot force huge allocations or deep recursion.
+// Zero fields mean no limit. Exceeding a limit fails with a *DecodeError wrapping ErrLimitExceeded.
+type Limits struct {
+	MaxDepth    int   // Maximum nesting depth of instances, the top-level instance being at depth 1
+	MaxArrayLen int   // Maximum number of elements of an array and fields of a struct
+	MaxBlobSize int   // Maximum size of a blob or bit array in bytes
+	MaxAlloc    int64 // Maximum total number of bytes allocated for a top-level instance (approximately)
+}
+
+// DefaultLimits are the limits used by the decoders created by NewVersionedDec and NewVersionedDecReader.
+// They are safe for untrusted input while still allowing any real s2mi, s2mh and s2gs file.
+var DefaultLimits = Limits{
+	MaxDepth:    64,
+	MaxArrayLen: 1 << 16,
+	MaxBlobSize: 16 << 20,
+	MaxAlloc:    64 << 20,
+}
+
+// ErrLimitExceeded is the cause of the *DecodeError returned when the input exceeds the Limits of the decoder.
+var ErrLimitExceeded = errors.New("limit exceeded")
+
+// slotAllocSize is the approximate number of bytes allocated for an element of an array or a field of a struct.
+const slotAllocSize = 16
+
+// enter increases the nesting depth and checks it against the limits, the caller must call leave when done.
+// Allocations are accounted from zero when the top-level instance is entered.
+func (d *VersionedDec) enter() error {
+	if d.depth == 0 {
+		d.allocated = 0
+	}
+	d.depth++
+	if d.Limits.MaxDepth > 0 && d.depth > d.Limits.MaxDepth {
+		return fmt.Errorf("%w: nesting depth exceeds %d", ErrLimitExceeded, d.Limits.MaxDepth)
+	}
+	return nil
+}
+
+// leave decreases the nesting depth.
+func (d *VersionedDec) leave() {
+	d.depth--
+}
+
+// checkCount checks the number of elements of an array or fields of a struct against the limits.
+func (d *VersionedDec) checkCount(n int) error {
+	if d.Limits.MaxArrayLen > 0 && n > d.Limits.MaxArrayLen {
+		return fmt.Errorf("%w: %d elements exceed %d", ErrLimitExceeded, n, d.Limits.MaxArrayLen)
 	}
+	return d.alloc(int64(n) * slotAllocSize)
+}
+
+// checkBlob checks the size of a blob or bit array against the limits.
+func (d *VersionedDec) checkBlob(n int) error {
+	if d.Limits.MaxBlobSize > 0 && n > d.Limits.MaxBlobSize {
+		return fmt.Errorf("%w: %d bytes exceed %d", ErrLimitExceeded, n, d.Limits.MaxBlobSize)
+	}
+	return d.alloc(int64(n))
+}
+
+// alloc accounts n bytes of allocation and checks the total against the limits.
+func (d *VersionedDec) alloc(n int64) error {
+	d.allocated += n
+	if d.Limits.MaxAlloc > 0 && d.allocated > d.Limits.MaxAlloc {
+		return fmt.Errorf("%w: allocating more than %d bytes", ErrLimitExceeded, d.Limits.MaxAlloc)
+	}
+	return nil
+}
+
+// bitArrayBytes returns the number of bytes holding n bits.
+func bitArrayBytes(n int) int {
+	if n%8 != 0 {
+		return n/8 + 1
+	}
+	return n / 8
 }
 
 // DataType of a field of struct.
@@ -41,107 +139,199 @@ const (
 	DataTypeVarInt   DataType = 0x09 // Int // An integer number
 )
 
-// ReadStruct decodes a value specified by dataType and returns the decoded value.
-// ReadStruct reads a nested data structure. If the type is not specified the first byte is used as the type identifier.
-func (d *VersionedDec) ReadStruct(dataTypes ...DataType) interface{} {
-	if len(dataTypes) < 1 {
-		dataTypes = []DataType{DataType(d.ReadBits8())}
-	}
+var errUnknownDataType = errors.New("unknown data type")
 
-	switch dataTypes[0] {
+// String returns the name of the DataType.
+func (t DataType) String() string {
+	switch t {
 	case DataTypeArray:
-		length := d.ReadVarInt()
-		arr := make([]interface{}, length)
-		for i := range arr {
-			arr[i] = d.ReadStruct()
-		}
-		return arr
+		return "array"
 	case DataTypeBitArray:
-		length := int(d.ReadVarInt())
-		barr := s2prot.BitArr{Count: length, Data: d.ReadAligned((length + 7) / 8)}
-		return barr
+		return "bitArray"
 	case DataTypeBlob:
-		length := int(d.ReadVarInt())
-		return string(d.ReadAligned(length))
+		return "blob"
 	case DataTypeChoice:
-		_ = int(d.ReadVarInt()) // flag
-		return d.ReadStruct()
+		return "choice"
 	case DataTypeOptional:
-		if exists := d.ReadBits8(); exists != 0 {
-			return d.ReadStruct()
-		}
-		return nil
+		return "optional"
 	case DataTypeStruct:
-		// TODO order should be preserved! Map does not preserve it!
-		s := s2prot.Struct{}
-		nEntries := int(d.ReadVarInt()) // length
-		for i := 0; i < nEntries; i++ {
-			s[strconv.Itoa(int(d.ReadVarInt()))] = d.ReadStruct()
-		}
-		return s
+		return "struct"
 	case DataTypeUint8:
-		return int64(d.ReadBits8()) // This is usually bool and is put int64 to be the same type as VarInt.
+		return "uint8"
 	case DataTypeUint32:
-		return string(d.ReadAligned(4))
+		return "uint32"
 	case DataTypeUint64:
-		return string(d.ReadAligned(8))
+		return "uint64"
 	case DataTypeVarInt:
-		return d.ReadVarInt()
-	default:
-		panic(fmt.Errorf("unknown data type: %d", dataTypes[0]))
+		return "varInt"
 	}
+	return "DataType(" + strconv.Itoa(int(t)) + ")"
+}
 
-	// return nil
+// DecodeError describes where and why decoding of the versioned format failed.
+type DecodeError struct {
+	Offset   int64    // Byte offset in the input at which the read failed
+	Bit      int64    // Bit offset in the input at which the read failed
+	DataType DataType // DataType of the instance being read, negative if its type identifier could not be read
+	Path     []string // Struct field tags and array indices leading to the instance, outermost first
+	Err      error    // Cause of the failure, io.ErrUnexpectedEOF on truncated input
+}
+
+// Error implements the error interface.
+func (e *DecodeError) Error() string {
+	sb := strings.Builder{}
+	fmt.Fprintf(&sb, "decoding error at byte %d (bit %d)", e.Offset, e.Bit)
+	if len(e.Path) > 0 {
+		fmt.Fprintf(&sb, " in %s", strings.Join(e.Path, "."))
+	}
+	if e.DataType >= 0 {
+		fmt.Fprintf(&sb, " reading %v", e.DataType)
+	} else {
+		sb.WriteString(" reading data type")
+	}
+	fmt.Fprintf(&sb, ": %v", e.Err)
+	return sb.String()
+}
+
+// Unwrap returns the cause of the failure.
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// newDecodeError creates a DecodeError located at the current position of the buffer.
+func (d *VersionedDec) newDecodeError(dataType DataType, err error) *DecodeError {
+	bit := d.bitOffset()
+	return &DecodeError{Offset: bit / 8, Bit: bit, DataType: dataType, Err: err}
+}
+
+// prependPath prepends a path element to err if it is a *DecodeError.
+func prependPath(err error, elem string) error {
+	if e, ok := err.(*DecodeError); ok {
+		e.Path = append([]string{elem}, e.Path...)
+	}
+	return err
+}
+
+// Decode decodes the next instance and returns it in the same representation as ReadStruct does.
+// Unlike ReadStruct, Decode does not panic on truncated or malformed input but returns a *DecodeError.
+func (d *VersionedDec) Decode() (interface{}, error) {
+	return d.decode()
+}
+
+// ReadStruct decodes a value specified by dataType and returns the decoded value.
+// ReadStruct reads a nested data structure. If the type is not specified the first byte is used as the type identifier.
+// ReadStruct panics with a *DecodeError if the input is truncated or malformed, see Decode.
+func (d *VersionedDec) ReadStruct(dataTypes ...DataType) interface{} {
+	v, err := d.decode(dataTypes...)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// decode is the error returning implementation of ReadStruct.
+func (d *VersionedDec) decode(dataTypes ...DataType) (interface{}, error) {
+	b := &structBuilder{dec: d}
+	if err := d.walk(b, dataTypes...); err != nil {
+		return nil, err
+	}
+	return b.result, nil
+}
+
+// DecodeValue decodes the next instance into a Value which keeps the exact wire type of every node.
+func (d *VersionedDec) DecodeValue() (*Value, error) {
+	return d.decodeValue()
+}
+
+// valueAllocSize is the approximate number of bytes allocated for a Value.
+const valueAllocSize = 128
+
+// readCount reads the length of an array, struct or blob and checks it with check.
+func (d *VersionedDec) readCount(check func(int) error) (int, error) {
+	n, err := d.readLength()
+	if err != nil {
+		return 0, err
+	}
+	return n, check(n)
+}
+
+// readBitArrayLength reads the number of bits of a bit array and checks its size in bytes against the limits.
+func (d *VersionedDec) readBitArrayLength() (int, error) {
+	n, err := d.readLength()
+	if err != nil {
+		return 0, err
+	}
+	return n, d.checkBlob(bitArrayBytes(n))
+}
+
+// decodeValue is the implementation of DecodeValue.
+func (d *VersionedDec) decodeValue() (*Value, error) {
+	b := &valueBuilder{dec: d}
+	if err := d.walk(b); err != nil {
+		return nil, err
+	}
+	return b.result, nil
 }
 
 // ReadVarInt reads a variable-length int value.
 // Format: read from input by 8 bits. Highest bit tells if have to read more bytes,
 // lowest bit of the first byte (first 8 bits) is not data but tells if the number is negative.
 func (b *BitPackedBuff) ReadVarInt() int64 {
+	v, err := b.readVarInt()
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// readBits8 is ReadBits8 that returns io.ErrUnexpectedEOF instead of panicking on truncated input.
+func (b *BitPackedBuff) readBits8() (byte, error) {
+	if !b.available(1) {
+		return 0, b.errShort()
+	}
+	return b.ReadBits8(), nil
+}
+
+// readVarInt is ReadVarInt that returns io.ErrUnexpectedEOF instead of panicking on truncated input.
+func (b *BitPackedBuff) readVarInt() (int64, error) {
 	var data, value int64
 	for shift := uint(0); ; shift += 7 {
-		data = int64(b.ReadBits8())
+		c, err := b.readBits8()
+		if err != nil {
+			return 0, err
+		}
+		data = int64(c)
 		value |= (data & 0x7f) << shift
 		if (data & 0x80) == 0 {
 			if value&0x01 > 0 {
-				return -(value >> 1)
+				return -(value >> 1), nil
 			}
-			return value >> 1
+			return value >> 1, nil
 		}
 	}
 }
 
-// SkipInstance reads and discards an instance whose type is deducted from the read Field type.
-func (b *BitPackedBuff) SkipInstance() {
-	fieldType := b.ReadBits8()
-	switch fieldType {
-	case 0: // array
-		for i := b.ReadVarInt(); i > 0; i-- {
-			b.SkipInstance()
-		}
-	case 1: // bit array
-		b.ReadAligned((int(b.ReadVarInt()) + 7) / 8)
-	case 2: // blob
-		b.ReadAligned(int(b.ReadVarInt()))
-	case 3: // choice
-		b.ReadVarInt() // tag
-		b.SkipInstance()
-	case 4: // optional
-		if b.ReadBits8() != 0 {
-			b.SkipInstance()
-		}
-	case 5: // struct
-		for i := b.ReadVarInt(); i > 0; i-- {
-			b.ReadVarInt() // tag
-			b.SkipInstance()
-		}
-	case 6: // uint8
-		b.ReadBits8() // b.ReadAligned(1)
-	case 7: // uint32
-		b.ReadAligned(4)
-	case 8: // uint64
-		b.ReadAligned(8)
-	case 9: // vint
-		b.ReadVarInt()
+// readLength reads a VarInt used as the length of an instance and rejects negative values.
+func (b *BitPackedBuff) readLength() (int, error) {
+	v, err := b.readVarInt()
+	if err != nil {
+		return 0, err
+	}
+	if v < 0 || int64(int(v)) != v {
+		return 0, fmt.Errorf("invalid length: %d", v)
+	}
+	return int(v), nil
+}
+
+// capHint returns the capacity to preallocate for n elements each taking at least one byte of the input,
+// so that a crafted length cannot allocate more than what the buffered input could hold.
+func (b *BitPackedBuff) capHint(n int) int {
+	m := len(b.contents) - b.idx
+	if b.src != nil {
+		m = cap(b.contents)
+	}
+	if n > m {
+		return m
 	}
+	return n
 }
@@ -0,0 +1,200 @@
+package s2mdec
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"testing/iotest"
+
+	"github.com/icza/s2prot"
+)
+
+// {0: 5, 1: "abc"}
+var testStructData = []byte{0x05, 0x04, 0x00, 0x09, 0x0a, 0x02, 0x02, 0x06, 'a', 'b', 'c'}
+
+func TestDecode(t *testing.T) {
+	v, err := NewVersionedDec(testStructData).Decode()
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if !reflect.DeepEqual(v, s2prot.Struct{"0": int64(5), "1": "abc"}) {
+		t.Error("Unexpected value!")
+	}
+}
+
+func TestDecodeTruncated(t *testing.T) {
+	for n := 0; n < len(testStructData); n++ {
+		_, err := NewVersionedDec(testStructData[:n]).Decode()
+		var decErr *DecodeError
+		if !errors.As(err, &decErr) {
+			t.Fatalf("Unexpected error at len %d: %v", n, err)
+		}
+		if !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("Unexpected cause at len %d: %v", n, decErr.Err)
+		}
+		if decErr.Offset != int64(n) && decErr.DataType != DataTypeBlob {
+			t.Errorf("Unexpected offset at len %d: %d", n, decErr.Offset)
+		}
+	}
+
+	_, err := NewVersionedDec(testStructData[:10]).Decode()
+	decErr := err.(*DecodeError)
+	if decErr.DataType != DataTypeBlob || !reflect.DeepEqual(decErr.Path, []string{"1"}) || decErr.Offset != 8 {
+		t.Error("Unexpected error:", decErr)
+	}
+}
+
+func TestDecodeUnknownDataType(t *testing.T) {
+	_, err := NewVersionedDec([]byte{0x00, 0x02, 0x0f}).Decode()
+	decErr, ok := err.(*DecodeError)
+	if !ok {
+		t.Fatal("Unexpected error:", err)
+	}
+	if decErr.DataType != 0x0f || decErr.Offset != 2 || !reflect.DeepEqual(decErr.Path, []string{"0"}) {
+		t.Error("Unexpected error:", decErr)
+	}
+}
+
+func TestDecodeOrderedStructs(t *testing.T) {
+	// {1: "abc", 0: {0: 5}}
+	data := []byte{0x05, 0x04, 0x02, 0x02, 0x06, 'a', 'b', 'c', 0x00, 0x05, 0x02, 0x00, 0x09, 0x0a}
+	dec := NewVersionedDec(data)
+	dec.OrderedStructs = true
+	v, err := dec.Decode()
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	s, ok := v.(OrderedStruct)
+	if !ok {
+		t.Fatalf("Unexpected type: %T", v)
+	}
+	if !reflect.DeepEqual(s.Tags(), []int64{1, 0}) {
+		t.Error("Unexpected order!")
+	}
+	if s.Value(0, 0) != int64(5) {
+		t.Error("Unexpected value!")
+	}
+	if b, _ := json.Marshal(s); string(b) != `{"1":"abc","0":{"0":5}}` {
+		t.Error("Unexpected JSON:", string(b))
+	}
+	buf := bytes.Buffer{}
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(OrderedStruct{{Tag: 0, Value: "<b>&"}}); err != nil || buf.String() != "{\"0\":\"<b>&\"}\n" {
+		t.Error("Unexpected JSON:", buf.String(), err)
+	}
+	if !reflect.DeepEqual(s.Struct(), s2prot.Struct{"0": s2prot.Struct{"0": int64(5)}, "1": "abc"}) {
+		t.Error("Unexpected value!")
+	}
+}
+
+func TestDecodeValue(t *testing.T) {
+	// {0: choice(3, uint8(1)), 1: uint32("abcd")}
+	data := []byte{0x05, 0x04, 0x00, 0x03, 0x06, 0x06, 0x01, 0x02, 0x07, 'a', 'b', 'c', 'd'}
+	v, err := NewVersionedDec(data).DecodeValue()
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if c := v.Field(0); c == nil || c.Type != DataTypeChoice || c.Tag != 3 || c.Elem.Type != DataTypeUint8 || c.Elem.Int != 1 {
+		t.Error("Unexpected value!")
+	}
+	if f := v.Field(1); f == nil || f.Type != DataTypeUint32 || string(f.Bytes) != "abcd" {
+		t.Error("Unexpected value!")
+	}
+	if !reflect.DeepEqual(v.Interface(), NewVersionedDec(data).ReadStruct()) {
+		t.Error("Unexpected value!")
+	}
+}
+
+func TestDecodeReader(t *testing.T) {
+	big := bytes.Repeat([]byte{'x'}, readerBufferSize+100)
+	bigData, err := Marshal(s2prot.Struct{"0": string(big)})
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	data := append(append(append([]byte{}, testStructData...), bigData...), testStructData...)
+
+	dec := NewVersionedDecReader(iotest.OneByteReader(bytes.NewReader(data)))
+	var offsets []int64
+	for !dec.EOF() {
+		v, err := dec.Decode()
+		if err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+		if s, ok := v.(s2prot.Struct); !ok || len(s) == 0 {
+			t.Error("Unexpected value!")
+		}
+		offsets = append(offsets, dec.BytesConsumed())
+	}
+	n := int64(len(testStructData))
+	if !reflect.DeepEqual(offsets, []int64{n, n + int64(len(bigData)), 2*n + int64(len(bigData))}) {
+		t.Error("Unexpected offsets:", offsets)
+	}
+
+	_, err = NewVersionedDecReader(bytes.NewReader(testStructData[:10])).Decode()
+	decErr, ok := err.(*DecodeError)
+	if !ok || !errors.Is(err, io.ErrUnexpectedEOF) || decErr.Offset != 8 {
+		t.Error("Unexpected error:", err)
+	}
+
+	_, err = NewVersionedDecReader(iotest.TimeoutReader(iotest.OneByteReader(bytes.NewReader(testStructData)))).Decode()
+	if !errors.Is(err, iotest.ErrTimeout) {
+		t.Error("Unexpected error:", err)
+	}
+}
+
+func TestDecodeLimits(t *testing.T) {
+	// Array claiming 1<<40 elements
+	hugeArray := []byte{0x00, 0x80, 0x80, 0x80, 0x80, 0x80, 0x40, 0x09, 0x00}
+	// Blob claiming 1<<40 bytes
+	hugeBlob := []byte{0x02, 0x80, 0x80, 0x80, 0x80, 0x80, 0x40, 'a'}
+	// 100 nested optionals
+	deep := append(bytes.Repeat([]byte{0x04, 0x01}, 100), 0x09, 0x00)
+
+	for i, data := range [][]byte{hugeArray, hugeBlob, deep} {
+		_, err := NewVersionedDec(data).Decode()
+		if _, ok := err.(*DecodeError); !ok || !errors.Is(err, ErrLimitExceeded) {
+			t.Errorf("Unexpected error at %d: %v", i, err)
+		}
+		_, err = NewVersionedDecReader(bytes.NewReader(data)).DecodeValue()
+		if !errors.Is(err, ErrLimitExceeded) {
+			t.Errorf("Unexpected error at %d: %v", i, err)
+		}
+	}
+
+	// Without limits the crafted lengths are reported as truncated input, not allocated
+	for i, data := range [][]byte{hugeArray, hugeBlob} {
+		dec := NewVersionedDec(data)
+		dec.Limits = Limits{}
+		if _, err := dec.Decode(); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("Unexpected error at %d: %v", i, err)
+		}
+		dec = NewVersionedDecReader(bytes.NewReader(data))
+		dec.Limits = Limits{}
+		if _, err := dec.Decode(); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("Unexpected error at %d: %v", i, err)
+		}
+	}
+	dec := NewVersionedDec(deep)
+	dec.Limits = Limits{}
+	if _, err := dec.Decode(); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+
+	// MaxAlloc is accounted per top-level instance
+	dec = NewVersionedDec(append(append([]byte{}, testStructData...), testStructData...))
+	dec.Limits = Limits{MaxAlloc: 40}
+	for i := 0; i < 2; i++ {
+		if _, err := dec.Decode(); err != nil {
+			t.Error("Unexpected error:", err)
+		}
+	}
+	dec = NewVersionedDec(testStructData)
+	dec.Limits = Limits{MaxAlloc: 20}
+	if _, err := dec.Decode(); !errors.Is(err, ErrLimitExceeded) {
+		t.Error("Unexpected error:", err)
+	}
+}
@@ -0,0 +1,149 @@
+// Implementation of the versioned encoder.
+
+package s2mdec
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// VersionedEnc is a versioned encoder, the counterpart of VersionedDec.
+type VersionedEnc struct {
+	*BitPackedWriter // Data destination: bit-packed writer
+}
+
+// NewVersionedEnc creates a new bit-packed encoder.
+func NewVersionedEnc() *VersionedEnc {
+	return &VersionedEnc{
+		BitPackedWriter: NewBitPackedWriter(true), // All versioned encoder uses big endian order
+	}
+}
+
+// EncodeValue encodes v and returns the encoded bytes.
+func EncodeValue(v *Value) ([]byte, error) {
+	e := NewVersionedEnc()
+	if err := e.WriteValue(v); err != nil {
+		return nil, err
+	}
+	return e.Bytes(), nil
+}
+
+// EncodeError describes why a Value could not be encoded.
+type EncodeError struct {
+	DataType DataType // DataType of the instance being written
+	Path     []string // Struct field tags and array indices leading to the instance, outermost first
+	Err      error    // Cause of the failure
+}
+
+// Error implements the error interface.
+func (e *EncodeError) Error() string {
+	if len(e.Path) > 0 {
+		return fmt.Sprintf("encoding error in %s writing %v: %v", strings.Join(e.Path, "."), e.DataType, e.Err)
+	}
+	return fmt.Sprintf("encoding error writing %v: %v", e.DataType, e.Err)
+}
+
+// Unwrap returns the cause of the failure.
+func (e *EncodeError) Unwrap() error {
+	return e.Err
+}
+
+// WriteValue encodes v including its type identifier.
+// Decoding the written bytes with VersionedDec.DecodeValue gives back v.
+func (e *VersionedEnc) WriteValue(v *Value) error {
+	if v == nil {
+		return &EncodeError{DataType: -1, Err: fmt.Errorf("nil value")}
+	}
+	e.WriteBits8(byte(v.Type))
+
+	switch v.Type {
+	case DataTypeArray:
+		e.WriteVarInt(int64(len(v.Elems)))
+		for i, elem := range v.Elems {
+			if err := e.WriteValue(elem); err != nil {
+				return prependEncodePath(err, strconv.Itoa(i))
+			}
+		}
+	case DataTypeBitArray:
+		if len(v.Bytes) != (v.Bits+7)/8 {
+			return &EncodeError{DataType: v.Type, Err: fmt.Errorf("%d bytes for %d bits", len(v.Bytes), v.Bits)}
+		}
+		e.WriteVarInt(int64(v.Bits))
+		e.WriteAligned(v.Bytes)
+	case DataTypeBlob:
+		e.WriteVarInt(int64(len(v.Bytes)))
+		e.WriteAligned(v.Bytes)
+	case DataTypeChoice:
+		e.WriteVarInt(v.Tag)
+		if err := e.WriteValue(v.Elem); err != nil {
+			return err
+		}
+	case DataTypeOptional:
+		if v.Elem == nil {
+			e.WriteBits8(0)
+			break
+		}
+		e.WriteBits8(1)
+		if err := e.WriteValue(v.Elem); err != nil {
+			return err
+		}
+	case DataTypeStruct:
+		e.WriteVarInt(int64(len(v.Fields)))
+		for _, f := range v.Fields {
+			e.WriteVarInt(f.Tag)
+			if err := e.WriteValue(f.Value); err != nil {
+				return prependEncodePath(err, strconv.FormatInt(f.Tag, 10))
+			}
+		}
+	case DataTypeUint8:
+		if v.Int < 0 || v.Int > 0xff {
+			return &EncodeError{DataType: v.Type, Err: fmt.Errorf("value out of range: %d", v.Int)}
+		}
+		e.WriteBits8(byte(v.Int))
+	case DataTypeUint32, DataTypeUint64:
+		n := 4
+		if v.Type == DataTypeUint64 {
+			n = 8
+		}
+		if len(v.Bytes) != n {
+			return &EncodeError{DataType: v.Type, Err: fmt.Errorf("%d bytes instead of %d", len(v.Bytes), n)}
+		}
+		e.WriteAligned(v.Bytes)
+	case DataTypeVarInt:
+		e.WriteVarInt(v.Int)
+	default:
+		return &EncodeError{DataType: v.Type, Err: errUnknownDataType}
+	}
+	return nil
+}
+
+// prependEncodePath prepends a path element to err if it is an *EncodeError.
+func prependEncodePath(err error, elem string) error {
+	if e, ok := err.(*EncodeError); ok {
+		e.Path = append([]string{elem}, e.Path...)
+	}
+	return err
+}
+
+// WriteVarInt writes a variable-length int value, the counterpart of BitPackedBuff.ReadVarInt.
+// Format: written by 8 bits, highest bit tells if more bytes follow,
+// lowest bit of the first byte is not data but tells if the number is negative.
+func (w *BitPackedWriter) WriteVarInt(v int64) {
+	var value uint64
+	if v < 0 {
+		value = uint64(-v)<<1 | 0x01
+	} else {
+		value = uint64(v) << 1
+	}
+	for {
+		data := byte(value & 0x7f)
+		if value >>= 7; value != 0 {
+			data |= 0x80
+		}
+		w.WriteBits8(data)
+		if value == 0 {
+			return
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package s2mdec
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteBits(t *testing.T) {
+	for _, bigEndian := range []bool{true, false} {
+		w := NewBitPackedWriter(bigEndian)
+		w.WriteBits(1, 3)
+		w.WriteBits(2, 13)
+		w.WriteBits1(true)
+		w.WriteBits(0x0104, 15)
+		w.WriteBits8(0xa5)
+		w.WriteAligned([]byte{7, 8})
+
+		bb := &BitPackedBuff{contents: w.Bytes(), bigEndian: bigEndian}
+		if bb.ReadBits(3) != 1 || bb.ReadBits(13) != 2 || !bb.ReadBits1() || bb.ReadBits(15) != 0x0104 {
+			t.Error("Unexpected value!")
+		}
+		if bb.ReadBits8() != 0xa5 {
+			t.Error("Unexpected value!")
+		}
+		if !bytes.Equal([]byte{7, 8}, bb.ReadAligned(2)) || !bb.EOF() {
+			t.Error("Unexpected value!")
+		}
+	}
+
+	// Same layout as in TestReadBits
+	w := NewBitPackedWriter(true)
+	w.WriteBits(1, 3)
+	w.WriteBits(2, 13)
+	w.WriteBits(1, 1)
+	w.WriteBits(0x0104, 15)
+	if !bytes.Equal([]byte{1, 2, 3, 4}, w.Bytes()) {
+		t.Errorf("Unexpected value: %x", w.Bytes())
+	}
+}
+
+func TestWriteVarInt(t *testing.T) {
+	for _, v := range []int64{0, 1, -1, 5, 63, 64, -64, 1000, -123456789, 1 << 40} {
+		w := NewBitPackedWriter(true)
+		w.WriteVarInt(v)
+		if got := (&BitPackedBuff{contents: w.Bytes(), bigEndian: true}).ReadVarInt(); got != v {
+			t.Errorf("Unexpected value: %d instead of %d", got, v)
+		}
+	}
+}
+
+func TestEncodeValueRoundTrip(t *testing.T) {
+	for _, data := range [][]byte{
+		testStructData,
+		// {1: "abc", 0: {0: 5}}
+		{0x05, 0x04, 0x02, 0x02, 0x06, 'a', 'b', 'c', 0x00, 0x05, 0x02, 0x00, 0x09, 0x0a},
+		// {0: choice(3, uint8(1)), 1: uint32("abcd")}
+		{0x05, 0x04, 0x00, 0x03, 0x06, 0x06, 0x01, 0x02, 0x07, 'a', 'b', 'c', 'd'},
+		// [optional(nil), optional(-3), bitArray(10, 0xff03), uint64("abcdefgh")]
+		{0x00, 0x08, 0x04, 0x00, 0x04, 0x01, 0x09, 0x07, 0x01, 0x14, 0xff, 0x03, 0x08, 'a', 'b', 'c', 'd', 'e', 'f', 'g', 'h'},
+	} {
+		v, err := NewVersionedDec(data).DecodeValue()
+		if err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+		encoded, err := EncodeValue(v)
+		if err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+		if !bytes.Equal(data, encoded) {
+			t.Errorf("Unexpected value: %x instead of %x", encoded, data)
+		}
+	}
+}
+
+func TestEncodeValueInvalid(t *testing.T) {
+	v := &Value{Type: DataTypeStruct, Fields: []ValueField{{Tag: 4, Value: &Value{Type: DataTypeUint32, Bytes: []byte("abc")}}}}
+	_, err := EncodeValue(v)
+	encErr, ok := err.(*EncodeError)
+	if !ok || encErr.DataType != DataTypeUint32 || len(encErr.Path) != 1 || encErr.Path[0] != "4" {
+		t.Error("Unexpected error:", err)
+	}
+}
@@ -0,0 +1,333 @@
+// Implementation of the event-driven (visitor) interface of the versioned decoder.
+
+package s2mdec
+
+import (
+	"strconv"
+
+	"github.com/icza/s2prot"
+)
+
+// Visitor receives the instances read by Walk as events, in the order they appear in the input.
+//
+// A struct is reported as BeginStruct, then Field followed by the instance of the field for each field, then EndStruct.
+// An array is reported as BeginArray, the instances of the elements, then EndArray.
+// Choice and Optional with present set to true are followed by the instance they hold.
+//
+// Returning an error from any method stops Walk, which returns the error wrapped in a *DecodeError.
+type Visitor interface {
+	BeginStruct(nFields int) error
+	Field(tag int64) error
+	EndStruct() error
+	BeginArray(length int) error
+	EndArray() error
+	Choice(tag int64) error
+	Optional(present bool) error
+	Int(dataType DataType, v int64) error   // DataTypeUint8 or DataTypeVarInt
+	Blob(dataType DataType, b []byte) error // DataTypeBlob, DataTypeUint32 or DataTypeUint64
+	BitArray(bits int, data []byte) error
+}
+
+// Walk reads the next instance and reports it to v in a single pass, without building its representation.
+// Walk returns a *DecodeError if the input is truncated or malformed, or v returns an error.
+func (d *VersionedDec) Walk(v Visitor) error {
+	return d.walk(v)
+}
+
+// walk is the implementation of Walk. If the type is not specified the first byte is used as the type identifier.
+func (d *VersionedDec) walk(v Visitor, dataTypes ...DataType) error {
+	start := d.bitOffset()
+	if len(dataTypes) < 1 {
+		t, err := d.readBits8()
+		if err != nil {
+			return d.newDecodeError(-1, err)
+		}
+		dataTypes = []DataType{DataType(t)}
+	}
+	dataType := dataTypes[0]
+
+	if err := d.enter(); err != nil {
+		return d.newDecodeError(dataType, err)
+	}
+	defer d.leave()
+
+	var err error
+	switch dataType {
+	case DataTypeArray:
+		var length int
+		if length, err = d.readCount(d.checkCount); err != nil {
+			break
+		}
+		if err = v.BeginArray(length); err != nil {
+			break
+		}
+		for i := 0; i < length; i++ {
+			if err := d.walk(v); err != nil {
+				return prependPath(err, strconv.Itoa(i))
+			}
+		}
+		err = v.EndArray()
+	case DataTypeBitArray:
+		var length int
+		var data []byte
+		if length, err = d.readBitArrayLength(); err != nil {
+			break
+		}
+		if data, err = d.readAligned(bitArrayBytes(length)); err != nil {
+			break
+		}
+		err = v.BitArray(length, data)
+	case DataTypeBlob:
+		var length int
+		var data []byte
+		if length, err = d.readCount(d.checkBlob); err != nil {
+			break
+		}
+		if data, err = d.readAligned(length); err != nil {
+			break
+		}
+		err = v.Blob(dataType, data)
+	case DataTypeChoice:
+		var tag int64
+		if tag, err = d.readVarInt(); err != nil {
+			break
+		}
+		if err = v.Choice(tag); err != nil {
+			break
+		}
+		return d.walk(v)
+	case DataTypeOptional:
+		var exists byte
+		if exists, err = d.readBits8(); err != nil {
+			break
+		}
+		if err = v.Optional(exists != 0); err != nil {
+			break
+		}
+		if exists != 0 {
+			return d.walk(v)
+		}
+	case DataTypeStruct:
+		var nEntries int
+		if nEntries, err = d.readCount(d.checkCount); err != nil {
+			break
+		}
+		if err = v.BeginStruct(nEntries); err != nil {
+			break
+		}
+		for i := 0; i < nEntries; i++ {
+			tag, err := d.readVarInt()
+			if err == nil {
+				err = v.Field(tag)
+			}
+			if err != nil {
+				return d.newDecodeError(dataType, err)
+			}
+			if err := d.walk(v); err != nil {
+				return prependPath(err, strconv.FormatInt(tag, 10))
+			}
+		}
+		err = v.EndStruct()
+	case DataTypeUint8:
+		var b byte
+		if b, err = d.readBits8(); err != nil {
+			break
+		}
+		err = v.Int(dataType, int64(b))
+	case DataTypeUint32, DataTypeUint64:
+		n := 4
+		if dataType == DataTypeUint64 {
+			n = 8
+		}
+		var data []byte
+		if data, err = d.readAligned(n); err != nil {
+			break
+		}
+		err = v.Blob(dataType, data)
+	case DataTypeVarInt:
+		var i int64
+		if i, err = d.readVarInt(); err != nil {
+			break
+		}
+		err = v.Int(dataType, i)
+	default:
+		return &DecodeError{Offset: start / 8, Bit: start, DataType: dataType, Err: errUnknownDataType}
+	}
+
+	if err != nil {
+		return d.newDecodeError(dataType, err)
+	}
+	return nil
+}
+
+// structBuilder is the Visitor building the representation returned by ReadStruct.
+type structBuilder struct {
+	dec    *VersionedDec
+	stack  []*structFrame // Arrays and structs being built, innermost last
+	result interface{}
+}
+
+// structFrame is an array or struct being built by structBuilder.
+type structFrame struct {
+	arr     []interface{}
+	s       s2prot.Struct
+	ordered OrderedStruct
+	tag     int64 // Tag of the field whose instance is next
+}
+
+// value adds v to the innermost array or struct, or makes it the result if there is none.
+func (b *structBuilder) value(v interface{}) error {
+	if len(b.stack) == 0 {
+		b.result = v
+		return nil
+	}
+	f := b.stack[len(b.stack)-1]
+	switch {
+	case f.s != nil:
+		f.s[strconv.FormatInt(f.tag, 10)] = v
+	case f.ordered != nil:
+		f.ordered = append(f.ordered, OrderedField{Tag: f.tag, Value: v})
+	default:
+		f.arr = append(f.arr, v)
+	}
+	return nil
+}
+
+// pop removes the innermost array or struct and returns it.
+func (b *structBuilder) pop() *structFrame {
+	f := b.stack[len(b.stack)-1]
+	b.stack = b.stack[:len(b.stack)-1]
+	return f
+}
+
+func (b *structBuilder) BeginStruct(nFields int) error {
+	f := &structFrame{}
+	if b.dec.OrderedStructs {
+		f.ordered = make(OrderedStruct, 0, b.dec.capHint(nFields))
+	} else {
+		f.s = s2prot.Struct{}
+	}
+	b.stack = append(b.stack, f)
+	return nil
+}
+
+func (b *structBuilder) Field(tag int64) error {
+	b.stack[len(b.stack)-1].tag = tag
+	return nil
+}
+
+func (b *structBuilder) EndStruct() error {
+	f := b.pop()
+	if f.s != nil {
+		return b.value(f.s)
+	}
+	return b.value(f.ordered)
+}
+
+func (b *structBuilder) BeginArray(length int) error {
+	b.stack = append(b.stack, &structFrame{arr: make([]interface{}, 0, b.dec.capHint(length))})
+	return nil
+}
+
+func (b *structBuilder) EndArray() error {
+	return b.value(b.pop().arr)
+}
+
+func (b *structBuilder) Choice(tag int64) error {
+	return nil // The choice is transparent, only the chosen instance is kept
+}
+
+func (b *structBuilder) Optional(present bool) error {
+	if !present {
+		return b.value(nil)
+	}
+	return nil
+}
+
+func (b *structBuilder) Int(dataType DataType, v int64) error {
+	return b.value(v) // Uint8 is usually bool and is put int64 to be the same type as VarInt.
+}
+
+func (b *structBuilder) Blob(dataType DataType, data []byte) error {
+	return b.value(string(data))
+}
+
+func (b *structBuilder) BitArray(bits int, data []byte) error {
+	return b.value(s2prot.BitArr{Count: bits, Data: data})
+}
+
+// valueBuilder is the Visitor building the Value returned by DecodeValue.
+type valueBuilder struct {
+	dec    *VersionedDec
+	stack  []*Value // Arrays, structs, choices and optionals being built, innermost last
+	tag    int64    // Tag of the struct field whose instance is next
+	result *Value
+}
+
+// add adds v to the innermost array, struct, choice or optional, or makes it the result if there is none.
+// Arrays, structs, and choices and optionals that hold an instance are pushed to the stack to be filled.
+func (b *valueBuilder) add(v *Value, push bool) error {
+	if err := b.dec.alloc(valueAllocSize); err != nil {
+		return err
+	}
+	if len(b.stack) == 0 {
+		b.result = v
+	} else {
+		switch p := b.stack[len(b.stack)-1]; p.Type {
+		case DataTypeArray:
+			p.Elems = append(p.Elems, v)
+		case DataTypeStruct:
+			p.Fields = append(p.Fields, ValueField{Tag: b.tag, Value: v})
+		default: // choice and optional hold a single instance
+			p.Elem = v
+			b.stack = b.stack[:len(b.stack)-1]
+		}
+	}
+	if push {
+		b.stack = append(b.stack, v)
+	}
+	return nil
+}
+
+func (b *valueBuilder) BeginStruct(nFields int) error {
+	return b.add(&Value{Type: DataTypeStruct, Fields: make([]ValueField, 0, b.dec.capHint(nFields))}, true)
+}
+
+func (b *valueBuilder) Field(tag int64) error {
+	b.tag = tag
+	return nil
+}
+
+func (b *valueBuilder) EndStruct() error {
+	b.stack = b.stack[:len(b.stack)-1]
+	return nil
+}
+
+func (b *valueBuilder) BeginArray(length int) error {
+	return b.add(&Value{Type: DataTypeArray, Elems: make([]*Value, 0, b.dec.capHint(length))}, true)
+}
+
+func (b *valueBuilder) EndArray() error {
+	b.stack = b.stack[:len(b.stack)-1]
+	return nil
+}
+
+func (b *valueBuilder) Choice(tag int64) error {
+	return b.add(&Value{Type: DataTypeChoice, Tag: tag}, true)
+}
+
+func (b *valueBuilder) Optional(present bool) error {
+	return b.add(&Value{Type: DataTypeOptional}, present)
+}
+
+func (b *valueBuilder) Int(dataType DataType, v int64) error {
+	return b.add(&Value{Type: dataType, Int: v}, false)
+}
+
+func (b *valueBuilder) Blob(dataType DataType, data []byte) error {
+	return b.add(&Value{Type: dataType, Bytes: data}, false)
+}
+
+func (b *valueBuilder) BitArray(bits int, data []byte) error {
+	return b.add(&Value{Type: DataTypeBitArray, Bits: bits, Bytes: data}, false)
+}
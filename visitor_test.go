@@ -0,0 +1,65 @@
+package s2mdec
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// eventRecorder is a Visitor recording the events as strings.
+type eventRecorder struct {
+	events []string
+	stopAt string // Event returning errStop
+}
+
+var errStop = errors.New("stop")
+
+func (r *eventRecorder) record(format string, a ...interface{}) error {
+	e := fmt.Sprintf(format, a...)
+	r.events = append(r.events, e)
+	if e == r.stopAt {
+		return errStop
+	}
+	return nil
+}
+
+func (r *eventRecorder) BeginStruct(n int) error { return r.record("{%d", n) }
+func (r *eventRecorder) Field(tag int64) error   { return r.record("%d:", tag) }
+func (r *eventRecorder) EndStruct() error        { return r.record("}") }
+func (r *eventRecorder) BeginArray(n int) error  { return r.record("[%d", n) }
+func (r *eventRecorder) EndArray() error         { return r.record("]") }
+func (r *eventRecorder) Choice(tag int64) error  { return r.record("choice %d", tag) }
+func (r *eventRecorder) Optional(p bool) error   { return r.record("optional %v", p) }
+func (r *eventRecorder) BitArray(n int, b []byte) error {
+	return r.record("bits %d %x", n, b)
+}
+func (r *eventRecorder) Int(t DataType, v int64) error {
+	return r.record("%v %d", t, v)
+}
+func (r *eventRecorder) Blob(t DataType, b []byte) error {
+	return r.record("%v %q", t, b)
+}
+
+func TestWalk(t *testing.T) {
+	// {0: [choice(3, uint8(1)), none], 1: uint32("abcd")}
+	data := []byte{0x05, 0x04, 0x00, 0x00, 0x04, 0x03, 0x06, 0x06, 0x01, 0x04, 0x00, 0x02, 0x07, 'a', 'b', 'c', 'd'}
+	r := &eventRecorder{}
+	if err := NewVersionedDec(data).Walk(r); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	expected := []string{"{2", "0:", "[2", "choice 3", "uint8 1", "optional false", "]", "1:", `uint32 "abcd"`, "}"}
+	if !reflect.DeepEqual(r.events, expected) {
+		t.Error("Unexpected events:", r.events)
+	}
+
+	r = &eventRecorder{stopAt: "optional false"}
+	err := NewVersionedDec(data).Walk(r)
+	var decErr *DecodeError
+	if !errors.As(err, &decErr) || !errors.Is(err, errStop) || !reflect.DeepEqual(decErr.Path, []string{"0", "1"}) {
+		t.Error("Unexpected error:", err)
+	}
+	if len(r.events) != 6 {
+		t.Error("Unexpected events:", r.events)
+	}
+}